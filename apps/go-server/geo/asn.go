@@ -0,0 +1,62 @@
+package geo
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// ASNProvider reads GeoLite2-ASN mmdb files. It only knows the autonomous
+// system of an IP, so it enriches the locations of the other providers.
+type ASNProvider struct {
+	reader   *geoip2.Reader
+	path     string
+	loadedAt time.Time
+}
+
+func OpenASN(path string) (*ASNProvider, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoLite2-ASN DB: %w", err)
+	}
+
+	log.Println("GeoLite2-ASN database loaded:", path)
+	return &ASNProvider{reader: reader, path: path, loadedAt: time.Now()}, nil
+}
+
+func (p *ASNProvider) Name() string { return "maxmind-asn" }
+
+// Enrich fills the autonomous system of loc, unless a provider already did
+func (p *ASNProvider) Enrich(ip net.IP, loc Location) Location {
+	if loc.ASN != 0 {
+		return loc
+	}
+
+	record, err := p.reader.ASN(ip)
+	if err != nil || record.AutonomousSystemNumber == 0 {
+		return loc
+	}
+
+	loc.ASN = record.AutonomousSystemNumber
+	loc.ASOrganization = record.AutonomousSystemOrganization
+	loc.Datacenter = loc.Datacenter || IsDatacenterASN(loc.ASN)
+	return loc
+}
+
+func (p *ASNProvider) Info() DatabaseInfo {
+	metadata := p.reader.Metadata()
+	return DatabaseInfo{
+		Provider:  p.Name(),
+		Type:      metadata.DatabaseType,
+		Path:      p.path,
+		BuildDate: time.Unix(int64(metadata.BuildEpoch), 0).UTC(),
+		LoadedAt:  p.loadedAt,
+	}
+}
+
+func (p *ASNProvider) Close() error {
+	return p.reader.Close()
+}
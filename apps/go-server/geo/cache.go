@@ -0,0 +1,83 @@
+package geo
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruCache is a bounded, concurrency safe LRU of lookups keyed by IP
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type lruEntry struct {
+	ip      string
+	loc     Location
+	expires time.Time // zero for entries kept until evicted
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:    size,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+func (c *lruCache) Get(ip string) (Location, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[ip]
+	if !ok {
+		return Location{}, false
+	}
+	entry := el.Value.(*lruEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, ip)
+		return Location{}, false
+	}
+	c.order.MoveToFront(el)
+	return entry.loc, true
+}
+
+func (c *lruCache) Add(ip string, loc Location) {
+	c.add(ip, loc, time.Time{})
+}
+
+// AddFor caches loc for ttl only, e.g. a failed lookup worth retrying later
+func (c *lruCache) AddFor(ip string, loc Location, ttl time.Duration) {
+	c.add(ip, loc, time.Now().Add(ttl))
+}
+
+func (c *lruCache) add(ip string, loc Location, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[ip]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.loc, entry.expires = loc, expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[ip] = c.order.PushFront(&lruEntry{ip: ip, loc: loc, expires: expires})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).ip)
+	}
+}
+
+func (c *lruCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element, c.size)
+	c.order.Init()
+}
@@ -0,0 +1,57 @@
+package geo
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+// Chain tries its providers in order until one resolves the IP
+type Chain []Provider
+
+func (c Chain) Name() string {
+	names := make([]string, len(c))
+	for i, p := range c {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (c Chain) Lookup(ip net.IP) (Location, error) {
+	var errs []error
+	for _, p := range c {
+		loc, err := p.Lookup(ip)
+		if err == nil {
+			return loc, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return Location{}, errors.Join(errs...)
+	}
+	return Location{}, ErrNotFound
+}
+
+func (c Chain) Close() error {
+	var errs []error
+	for _, p := range c {
+		if err := p.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Info describes the databases of the chain, in lookup order
+func (c Chain) Info() []DatabaseInfo {
+	infos := []DatabaseInfo{}
+	for _, p := range c {
+		if d, ok := p.(Describer); ok {
+			infos = append(infos, d.Info())
+		}
+	}
+	return infos
+}
@@ -0,0 +1,43 @@
+package geo
+
+// datacenterASNs are the autonomous systems of the large cloud and hosting
+// providers. Traffic from them is almost always bots, crawlers or uptime
+// checks rather than people.
+var datacenterASNs = map[uint]bool{
+	16509:  true, // Amazon AWS
+	14618:  true, // Amazon AWS
+	8987:   true, // Amazon AWS
+	15169:  true, // Google
+	396982: true, // Google Cloud
+	19527:  true, // Google Cloud
+	8075:   true, // Microsoft Azure
+	8068:   true, // Microsoft Azure
+	31898:  true, // Oracle Cloud
+	14061:  true, // DigitalOcean
+	16276:  true, // OVH
+	24940:  true, // Hetzner
+	213230: true, // Hetzner Cloud
+	63949:  true, // Linode/Akamai
+	20473:  true, // Vultr
+	51167:  true, // Contabo
+	12876:  true, // Scaleway
+	60781:  true, // Leaseweb
+	16265:  true, // Leaseweb
+	45102:  true, // Alibaba Cloud
+	37963:  true, // Alibaba Cloud
+	132203: true, // Tencent Cloud
+	45090:  true, // Tencent Cloud
+	13335:  true, // Cloudflare
+	54113:  true, // Fastly
+	36352:  true, // ColoCrossing
+	46606:  true, // Unified Layer
+	62567:  true, // DigitalOcean
+	197540: true, // netcup
+	9009:   true, // M247
+}
+
+// IsDatacenterASN reports whether an autonomous system belongs to a known
+// cloud or hosting provider
+func IsDatacenterASN(asn uint) bool {
+	return datacenterASNs[asn]
+}
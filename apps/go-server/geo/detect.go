@@ -0,0 +1,57 @@
+package geo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	FormatMMDB        = "mmdb"
+	FormatIP2Location = "ip2location"
+)
+
+// the mmdb metadata section starts with this marker, within the last 128KiB
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+const mmdbMetadataMaxSize = 128 * 1024
+
+// DetectFormat tells MaxMind mmdb files and IP2Location BIN files apart by
+// their content, so the file extension doesn't matter.
+func DetectFormat(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	tailSize := info.Size()
+	if tailSize > mmdbMetadataMaxSize {
+		tailSize = mmdbMetadataMaxSize
+	}
+	tail := make([]byte, tailSize)
+	if _, err := file.ReadAt(tail, info.Size()-tailSize); err != nil && err != io.EOF {
+		return "", err
+	}
+	if bytes.Contains(tail, mmdbMetadataMarker) {
+		return FormatMMDB, nil
+	}
+
+	// IP2Location BIN header: db type, column count, yy, mm, dd, ...
+	header := make([]byte, 5)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return "", err
+	}
+	dbType, columns, month, day := header[0], header[1], header[3], header[4]
+	if dbType >= 1 && dbType <= 26 && columns > 0 && month >= 1 && month <= 12 && day >= 1 && day <= 31 {
+		return FormatIP2Location, nil
+	}
+
+	return "", fmt.Errorf("unrecognized geo database format: %s", path)
+}
@@ -0,0 +1,76 @@
+package geo
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrNotFound is returned by providers that have no data for an IP
+var ErrNotFound = errors.New("geo: ip not found")
+
+// Location is the geo data resolved for an IP.
+// Country holds the ISO country code, fields a database lacks are left empty.
+type Location struct {
+	Country    string
+	City       string
+	Region     string
+	Continent  string
+	PostalCode string
+	Latitude   *float64
+	Longitude  *float64
+	Timezone   string
+	ISP        string
+
+	// autonomous system, from a GeoLite2-ASN database or the provider
+	ASN            uint
+	ASOrganization string
+	Datacenter     bool
+}
+
+// Unknown is used when no provider could resolve an IP
+var Unknown = Location{Country: "Unknown", City: "Unknown"}
+
+// Private is used for private and loopback IPs, they are never looked up
+var Private = Location{Country: "Private IP", City: "Private IP"}
+
+// Provider resolves IPs to locations, e.g. from a local database
+type Provider interface {
+	Name() string
+	Lookup(ip net.IP) (Location, error)
+	Close() error
+}
+
+// coordinates returns nil coordinates for the 0,0 databases report when
+// they have none
+func coordinates(lat, lon float64) (*float64, *float64) {
+	if lat == 0 && lon == 0 {
+		return nil, nil
+	}
+	return &lat, &lon
+}
+
+// DatabaseInfo describes a loaded geo database
+type DatabaseInfo struct {
+	Provider  string    `json:"provider"`
+	Type      string    `json:"type"`
+	Path      string    `json:"path"`
+	BuildDate time.Time `json:"buildDate"`
+	LoadedAt  time.Time `json:"loadedAt"`
+}
+
+// Describer is implemented by providers backed by a database file
+type Describer interface {
+	Info() DatabaseInfo
+}
+
+// fillUnknown replaces missing fields so stored events never hold empty values
+func fillUnknown(loc Location) Location {
+	if loc.Country == "" {
+		loc.Country = "Unknown"
+	}
+	if loc.City == "" {
+		loc.City = "Unknown"
+	}
+	return loc
+}
@@ -0,0 +1,108 @@
+package geo
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ip2location/ip2location-go/v9"
+)
+
+// IP2LocationProvider reads IP2Location BIN files
+type IP2LocationProvider struct {
+	db       *ip2location.DB
+	path     string
+	loadedAt time.Time
+}
+
+func OpenIP2Location(path string) (*IP2LocationProvider, error) {
+	db, err := ip2location.OpenDB(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open IP2Location DB: %w", err)
+	}
+
+	log.Println("IP2Location database loaded:", path)
+	return &IP2LocationProvider{db: db, path: path, loadedAt: time.Now()}, nil
+}
+
+func (p *IP2LocationProvider) Name() string { return "ip2location" }
+
+func (p *IP2LocationProvider) Lookup(ip net.IP) (Location, error) {
+	record, err := p.db.Get_all(ip.String())
+	if err != nil {
+		return Location{}, err
+	}
+
+	country := ip2locationValue(record.Country_short)
+	if country == "" {
+		return Location{}, ErrNotFound
+	}
+
+	loc := Location{
+		Country:        country,
+		City:           ip2locationValue(record.City),
+		Region:         ip2locationValue(record.Region),
+		PostalCode:     ip2locationValue(record.Zipcode),
+		Timezone:       ip2locationTimezone(record.Timezone),
+		ISP:            ip2locationValue(record.Isp),
+		ASOrganization: ip2locationValue(record.As),
+	}
+	loc.Latitude, loc.Longitude = coordinates(float64(record.Latitude), float64(record.Longitude))
+
+	if asn, err := strconv.ParseUint(ip2locationValue(record.Asn), 10, 32); err == nil {
+		loc.ASN = uint(asn)
+	}
+	loc.Datacenter = ip2locationDatacenter[ip2locationValue(record.Usagetype)] || IsDatacenterASN(loc.ASN)
+
+	return loc, nil
+}
+
+func (p *IP2LocationProvider) Info() DatabaseInfo {
+	// DatabaseVersion is formatted as "20YY.M.D"
+	buildDate, _ := time.Parse("2006.1.2", p.db.DatabaseVersion())
+	return DatabaseInfo{
+		Provider:  p.Name(),
+		Type:      "IP2Location DB" + p.db.PackageVersion(),
+		Path:      p.path,
+		BuildDate: buildDate,
+		LoadedAt:  p.loadedAt,
+	}
+}
+
+func (p *IP2LocationProvider) Close() error {
+	p.db.Close()
+	return nil
+}
+
+// usage types of data centres, hosting and content delivery networks
+var ip2locationDatacenter = map[string]bool{
+	"DCH": true,
+	"CDN": true,
+}
+
+// ip2locationValue drops the placeholders the library returns for missing
+// data, "-" for unknown and a message for fields the BIN file lacks
+func ip2locationValue(value string) string {
+	if value == "-" || strings.HasPrefix(value, "This parameter is unavailable") ||
+		strings.HasPrefix(value, "Invalid") {
+		return ""
+	}
+	return value
+}
+
+// ip2locationTimezone keeps the timezone only when it is an IANA name.
+// IP2Location mostly stores UTC offsets like "+01:00", which can't tell
+// DST rules apart, so those are left empty.
+func ip2locationTimezone(value string) string {
+	value = ip2locationValue(value)
+	if value == "" || strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-") {
+		return ""
+	}
+	if _, err := time.LoadLocation(value); err != nil || value == "Local" {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,74 @@
+package geo
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// MaxMindProvider reads GeoLite2/GeoIP2 City mmdb files
+type MaxMindProvider struct {
+	reader   *geoip2.Reader
+	path     string
+	loadedAt time.Time
+}
+
+func OpenMaxMind(path string) (*MaxMindProvider, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MaxMind GeoLite2 DB: %w", err)
+	}
+
+	if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > 30*24*time.Hour {
+		log.Println("GeoLite2 DB may be outdated. Update recommended.")
+	}
+
+	log.Println("GeoLite2 database loaded:", path)
+	return &MaxMindProvider{reader: reader, path: path, loadedAt: time.Now()}, nil
+}
+
+func (p *MaxMindProvider) Name() string { return "maxmind" }
+
+func (p *MaxMindProvider) Lookup(ip net.IP) (Location, error) {
+	record, err := p.reader.City(ip)
+	if err != nil {
+		return Location{}, err
+	}
+
+	if record.Country.IsoCode == "" {
+		return Location{}, ErrNotFound
+	}
+
+	loc := Location{
+		Country:    record.Country.IsoCode,
+		City:       record.City.Names["en"],
+		Continent:  record.Continent.Code,
+		PostalCode: record.Postal.Code,
+		Timezone:   record.Location.TimeZone,
+	}
+	if len(record.Subdivisions) > 0 {
+		loc.Region = record.Subdivisions[0].Names["en"]
+	}
+	loc.Latitude, loc.Longitude = coordinates(record.Location.Latitude, record.Location.Longitude)
+
+	return loc, nil
+}
+
+func (p *MaxMindProvider) Info() DatabaseInfo {
+	metadata := p.reader.Metadata()
+	return DatabaseInfo{
+		Provider:  p.Name(),
+		Type:      metadata.DatabaseType,
+		Path:      p.path,
+		BuildDate: time.Unix(int64(metadata.BuildEpoch), 0).UTC(),
+		LoadedAt:  p.loadedAt,
+	}
+}
+
+func (p *MaxMindProvider) Close() error {
+	return p.reader.Close()
+}
@@ -0,0 +1,30 @@
+package geo
+
+import (
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// CountryName returns the name of an ISO country code in the given locale,
+// e.g. "DE" is "Germany" in "en" and "Deutschland" in "de". Unknown
+// locales fall back to English and unknown codes are returned as is.
+func CountryName(code, locale string) string {
+	region, err := language.ParseRegion(code)
+	if err != nil {
+		return code
+	}
+
+	tag, err := language.Parse(locale)
+	if err != nil {
+		tag = language.English
+	}
+
+	for _, t := range []language.Tag{tag, language.English} {
+		if namer := display.Regions(t); namer != nil {
+			if name := namer.Name(region); name != "" {
+				return name
+			}
+		}
+	}
+	return code
+}
@@ -0,0 +1,14 @@
+package geo
+
+import "net"
+
+// NullProvider resolves nothing, used when no database is configured
+type NullProvider struct{}
+
+func (NullProvider) Name() string { return "null" }
+
+func (NullProvider) Lookup(ip net.IP) (Location, error) {
+	return Location{}, ErrNotFound
+}
+
+func (NullProvider) Close() error { return nil }
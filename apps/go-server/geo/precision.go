@@ -0,0 +1,51 @@
+package geo
+
+import "math"
+
+// Precision is how much location detail a project stores
+const (
+	PrecisionCity    = "city"
+	PrecisionRegion  = "region"
+	PrecisionCountry = "country"
+)
+
+// postal codes are cut to this prefix, e.g. the first 3 digits of a ZIP code
+const postalPrefixLength = 3
+
+func IsValidPrecision(precision string) bool {
+	return precision == PrecisionCity || precision == PrecisionRegion || precision == PrecisionCountry
+}
+
+// WithPrecision coarsens a location to the given precision. Postal codes
+// are always cut to a prefix and coordinates are rounded, to about 1km at
+// city precision and 10km at region precision.
+func (l Location) WithPrecision(precision string) Location {
+	switch precision {
+	case PrecisionCountry:
+		l.Region, l.City, l.PostalCode = "", "", ""
+		l.Latitude, l.Longitude = nil, nil
+	case PrecisionRegion:
+		l.City, l.PostalCode = "", ""
+		l.Latitude, l.Longitude = round(l.Latitude, 1), round(l.Longitude, 1)
+	default:
+		l.PostalCode = postalPrefix(l.PostalCode)
+		l.Latitude, l.Longitude = round(l.Latitude, 2), round(l.Longitude, 2)
+	}
+	return l
+}
+
+func postalPrefix(code string) string {
+	if len(code) <= postalPrefixLength {
+		return code
+	}
+	return code[:postalPrefixLength]
+}
+
+func round(value *float64, decimals int) *float64 {
+	if value == nil {
+		return nil
+	}
+	factor := math.Pow(10, float64(decimals))
+	rounded := math.Round(*value*factor) / factor
+	return &rounded
+}
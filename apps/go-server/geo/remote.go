@@ -0,0 +1,84 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const remoteTimeout = 2 * time.Second
+
+// RemoteProvider looks IPs up on ip-api.com. It sends visitor IPs to a
+// third party, so it is only used when GEOIP_REMOTE_FALLBACK is enabled,
+// and only asynchronously through the Resolver.
+type RemoteProvider struct {
+	client *http.Client
+}
+
+func NewRemoteProvider() *RemoteProvider {
+	return &RemoteProvider{client: &http.Client{Timeout: remoteTimeout}}
+}
+
+func (p *RemoteProvider) Name() string { return "ip-api" }
+
+func (p *RemoteProvider) Lookup(ip net.IP) (Location, error) {
+	url := fmt.Sprintf("http://ip-api.com/json/%s?fields=status,message,continentCode,countryCode,regionName,city,zip,lat,lon,timezone,isp,org,as,hosting", ip)
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return Location{}, fmt.Errorf("remote lookup failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Status        string  `json:"status"`
+		ContinentCode string  `json:"continentCode"`
+		CountryCode   string  `json:"countryCode"`
+		RegionName    string  `json:"regionName"`
+		City          string  `json:"city"`
+		Zip           string  `json:"zip"`
+		Lat           float64 `json:"lat"`
+		Lon           float64 `json:"lon"`
+		Timezone      string  `json:"timezone"`
+		ISP           string  `json:"isp"`
+		Org           string  `json:"org"`
+		AS            string  `json:"as"`
+		Hosting       bool    `json:"hosting"`
+		Message       string  `json:"message"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return Location{}, err
+	}
+
+	if data.Status != "success" {
+		return Location{}, fmt.Errorf("remote lookup error: %s", data.Message)
+	}
+
+	loc := Location{
+		Country:        data.CountryCode,
+		City:           data.City,
+		Region:         data.RegionName,
+		Continent:      data.ContinentCode,
+		PostalCode:     data.Zip,
+		Timezone:       data.Timezone,
+		ISP:            data.ISP,
+		ASOrganization: data.Org,
+	}
+	loc.Latitude, loc.Longitude = coordinates(data.Lat, data.Lon)
+
+	// "as" is formatted as "AS15169 Google LLC"
+	if number, _, ok := strings.Cut(strings.TrimPrefix(data.AS, "AS"), " "); ok {
+		if asn, err := strconv.ParseUint(number, 10, 32); err == nil {
+			loc.ASN = uint(asn)
+		}
+	}
+	loc.Datacenter = data.Hosting || IsDatacenterASN(loc.ASN)
+
+	return loc, nil
+}
+
+func (p *RemoteProvider) Close() error { return nil }
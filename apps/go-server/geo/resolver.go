@@ -0,0 +1,444 @@
+package geo
+
+import (
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultCacheSize  = 10_000
+	maxRemoteInflight = 8
+
+	// failed remote lookups, timeouts or rate limits, are retried after this
+	remoteRetryAfter = time.Minute
+)
+
+// databases are the local providers loaded together, so they are
+// swapped and closed as one on reload. They are reference counted, the
+// resolver holds one reference and every running lookup another, and are
+// closed once the last one is released.
+type databases struct {
+	chain Chain
+	asn   *ASNProvider
+	refs  atomic.Int64
+}
+
+func newDatabases(chain Chain, asn *ASNProvider) *databases {
+	d := &databases{chain: chain, asn: asn}
+	d.refs.Store(1)
+	return d
+}
+
+// acquire takes a reference, it fails once the databases were closed
+func (d *databases) acquire() bool {
+	for {
+		n := d.refs.Load()
+		if n <= 0 {
+			return false
+		}
+		if d.refs.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// release drops a reference and closes the databases with the last one
+func (d *databases) release() {
+	if d.refs.Add(-1) != 0 {
+		return
+	}
+	if err := d.Close(); err != nil {
+		log.Println("failed to close geo database:", err)
+	}
+}
+
+// Lookup resolves an IP through the chain and adds its autonomous system
+func (d *databases) Lookup(ip net.IP) (Location, error) {
+	loc, err := d.chain.Lookup(ip)
+	if err != nil {
+		return Location{}, err
+	}
+	return d.withASN(ip, loc), nil
+}
+
+func (d *databases) withASN(ip net.IP, loc Location) Location {
+	if d.asn == nil {
+		return loc
+	}
+	return d.asn.Enrich(ip, loc)
+}
+
+func (d *databases) Info() []DatabaseInfo {
+	infos := d.chain.Info()
+	if d.asn != nil {
+		infos = append(infos, d.asn.Info())
+	}
+	return infos
+}
+
+func (d *databases) Close() error {
+	err := d.chain.Close()
+	if d.asn != nil {
+		err = errors.Join(err, d.asn.Close())
+	}
+	return err
+}
+
+// Resolver looks IPs up through the local providers, caching the results.
+// The optional remote provider never blocks a lookup, it runs in the
+// background and its result is served from the cache on the next hit.
+// The local databases can be reloaded from their paths without a restart.
+type Resolver struct {
+	paths   []string
+	asnPath string
+	local   atomic.Pointer[databases]
+	remote  Provider
+	cache   *lruCache
+
+	reloadMu sync.Mutex
+	inflight sync.Map
+	slots    chan struct{}
+}
+
+func NewResolver(local Chain, remote Provider, cacheSize int) *Resolver {
+	if cacheSize <= 0 {
+		cacheSize = defaultCacheSize
+	}
+	r := &Resolver{
+		remote: remote,
+		cache:  newLRUCache(cacheSize),
+		slots:  make(chan struct{}, maxRemoteInflight),
+	}
+	r.local.Store(newDatabases(local, nil))
+	return r
+}
+
+// OpenResolver opens the databases at paths and the optional ASN database,
+// they can later be reloaded
+func OpenResolver(paths []string, asnPath string, remote Provider, cacheSize int) (*Resolver, error) {
+	local, err := openDatabases(paths, asnPath)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewResolver(nil, remote, cacheSize)
+	r.paths = paths
+	r.asnPath = asnPath
+	r.local.Store(local)
+	return r, nil
+}
+
+// Lookup resolves an IP string, it never fails and falls back to Unknown
+func (r *Resolver) Lookup(ipStr string) Location {
+	ip := net.ParseIP(strings.TrimSpace(ipStr))
+	if ip == nil {
+		return Unknown
+	}
+
+	if ip.IsPrivate() || ip.IsLoopback() {
+		return Private
+	}
+
+	key := ip.String()
+	if loc, ok := r.cache.Get(key); ok {
+		return loc
+	}
+
+	local := r.acquire()
+	if local == nil {
+		return Unknown
+	}
+	defer local.release()
+
+	loc, err := local.Lookup(ip)
+	if err == nil {
+		loc = fillUnknown(loc)
+		r.cache.Add(key, loc)
+		return loc
+	}
+
+	if r.remote != nil {
+		r.lookupRemote(key, ip)
+		return local.withASN(ip, Unknown)
+	}
+
+	if !isNotFound(err) {
+		log.Println("geo lookup error:", err)
+	}
+	loc = local.withASN(ip, Unknown)
+	r.cache.Add(key, loc)
+	return loc
+}
+
+// lookupRemote fills the cache from the remote provider in the background.
+// Lookups are deduplicated per IP and dropped when all slots are busy.
+func (r *Resolver) lookupRemote(key string, ip net.IP) {
+	if _, busy := r.inflight.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+
+	select {
+	case r.slots <- struct{}{}:
+	default:
+		r.inflight.Delete(key)
+		return
+	}
+
+	go func() {
+		defer func() {
+			<-r.slots
+			r.inflight.Delete(key)
+		}()
+
+		loc, err := r.remote.Lookup(ip)
+		if err != nil {
+			r.cache.AddFor(key, Unknown, remoteRetryAfter)
+			return
+		}
+		r.cache.Add(key, fillUnknown(loc))
+	}()
+}
+
+// acquire returns the current databases with a reference taken, nil once
+// the resolver was closed
+func (r *Resolver) acquire() *databases {
+	for {
+		local := r.local.Load()
+		if local.acquire() {
+			return local
+		}
+		// released by a reload in between, retry with the new databases
+		if r.local.Load() == local {
+			return nil
+		}
+	}
+}
+
+// Reload reopens the databases and swaps them in atomically. Lookups
+// already running finish on the old databases, which are closed when the
+// last of them is done. On error the current databases are kept.
+func (r *Resolver) Reload() error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	if len(r.paths) == 0 && r.asnPath == "" {
+		return nil
+	}
+
+	local, err := openDatabases(r.paths, r.asnPath)
+	if err != nil {
+		return err
+	}
+
+	old := r.local.Swap(local)
+	r.cache.Purge()
+	log.Println("GeoIP databases reloaded:", strings.Join(r.files(), ", "))
+
+	old.release()
+	return nil
+}
+
+// Watch polls the database files and reloads once a changed file has
+// stopped changing, so half-written downloads are not picked up.
+func (r *Resolver) Watch(interval time.Duration) {
+	if len(r.files()) == 0 {
+		return
+	}
+
+	go func() {
+		loaded := r.modTimes()
+		seen := loaded
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			current := r.modTimes()
+			if current == loaded {
+				seen = current
+				continue
+			}
+			if current != seen {
+				// still changing, check again next tick
+				seen = current
+				continue
+			}
+
+			if err := r.Reload(); err != nil {
+				log.Println("GeoIP reload failed, keeping current databases:", err)
+			}
+			loaded = current
+		}
+	}()
+}
+
+// modTimes fingerprints the database files by size and modification time
+func (r *Resolver) modTimes() string {
+	var b strings.Builder
+	for _, path := range r.files() {
+		if info, err := os.Stat(path); err == nil {
+			b.WriteString(strconv.FormatInt(info.Size(), 10))
+			b.WriteString(":")
+			b.WriteString(strconv.FormatInt(info.ModTime().UnixNano(), 10))
+		}
+		b.WriteString(";")
+	}
+	return b.String()
+}
+
+// files are the paths of all the databases the resolver loaded
+func (r *Resolver) files() []string {
+	if r.asnPath == "" {
+		return r.paths
+	}
+	return append(append([]string{}, r.paths...), r.asnPath)
+}
+
+// Info describes the loaded databases
+func (r *Resolver) Info() []DatabaseInfo {
+	local := r.acquire()
+	if local == nil {
+		return nil
+	}
+	defer local.release()
+	return local.Info()
+}
+
+func (r *Resolver) RemoteEnabled() bool {
+	return r.remote != nil
+}
+
+// Close releases the resolver's reference, the databases are closed once
+// running lookups are done
+func (r *Resolver) Close() error {
+	r.local.Load().release()
+	return nil
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+var defaultResolver = NewResolver(Chain{NullProvider{}}, nil, defaultCacheSize)
+
+// Init sets up the default resolver from the environment:
+//   - IP2LOCATION_DB_PATH: local databases, mmdb or IP2Location .bin files,
+//     comma separated and tried in order
+//   - GEOIP_ASN_DB_PATH: a GeoLite2-ASN mmdb adding the autonomous system
+//   - GEOIP_CACHE_SIZE: number of IPs kept in memory
+//   - GEOIP_REMOTE_FALLBACK: "true" to resolve misses through ip-api.com
+func Init() error {
+	var remote Provider
+	if os.Getenv("GEOIP_REMOTE_FALLBACK") == "true" {
+		log.Println("GeoIP remote fallback enabled, misses are sent to ip-api.com")
+		remote = NewRemoteProvider()
+	}
+
+	cacheSize, _ := strconv.Atoi(os.Getenv("GEOIP_CACHE_SIZE"))
+
+	paths := os.Getenv("IP2LOCATION_DB_PATH")
+	asnPath := strings.TrimSpace(os.Getenv("GEOIP_ASN_DB_PATH"))
+	if paths == "" {
+		log.Println("WARNING: IP2LOCATION_DB_PATH not set. GeoIP lookups will use fallbacks.")
+		if asnPath == "" {
+			defaultResolver = NewResolver(Chain{NullProvider{}}, remote, cacheSize)
+			return nil
+		}
+	}
+
+	var cleaned []string
+	for _, path := range strings.Split(paths, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			cleaned = append(cleaned, path)
+		}
+	}
+
+	resolver, err := OpenResolver(cleaned, asnPath, remote, cacheSize)
+	if err != nil {
+		return err
+	}
+	defaultResolver = resolver
+	return nil
+}
+
+func openDatabases(paths []string, asnPath string) (*databases, error) {
+	chain, err := openChain(paths)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		chain = Chain{NullProvider{}}
+	}
+
+	var asn *ASNProvider
+	if asnPath != "" {
+		asn, err = OpenASN(asnPath)
+		if err != nil {
+			chain.Close()
+			return nil, err
+		}
+	}
+	return newDatabases(chain, asn), nil
+}
+
+func openChain(paths []string) (Chain, error) {
+	var chain Chain
+	for _, path := range paths {
+		provider, err := openProvider(path)
+		if err != nil {
+			chain.Close()
+			return nil, err
+		}
+		chain = append(chain, provider)
+	}
+	return chain, nil
+}
+
+func openProvider(path string) (Provider, error) {
+	format, err := DetectFormat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == FormatIP2Location {
+		return OpenIP2Location(path)
+	}
+	return OpenMaxMind(path)
+}
+
+// Lookup resolves an IP with the default resolver
+func Lookup(ip string) Location {
+	return defaultResolver.Lookup(ip)
+}
+
+// Reload reopens the default resolver's databases
+func Reload() error {
+	return defaultResolver.Reload()
+}
+
+// Watch reloads the default resolver's databases when their files change
+func Watch(interval time.Duration) {
+	defaultResolver.Watch(interval)
+}
+
+// Info describes the default resolver's databases
+func Info() []DatabaseInfo {
+	return defaultResolver.Info()
+}
+
+// RemoteEnabled reports whether misses are resolved through ip-api.com
+func RemoteEnabled() bool {
+	return defaultResolver.RemoteEnabled()
+}
+
+// Close releases the default resolver's databases
+func Close() error {
+	return defaultResolver.Close()
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Delta is the change of a metric against the comparison range.
+// Percentage is nil when the comparison value is 0.
+type Delta struct {
+	Absolute   int      `json:"absolute"`
+	Percentage *float64 `json:"percentage"`
+}
+
+func newDelta(current, previous int) Delta {
+	delta := Delta{Absolute: current - previous}
+	if previous != 0 {
+		percentage := math.Round(float64(current-previous)/float64(previous)*1000) / 10
+		delta.Percentage = &percentage
+	}
+	return delta
+}
+
+// parseCompareRange derives the comparison range of tr:
+//   - previous_period: the range of the same length right before tr, whole
+//     calendar months shift by months so e.g. thismonth compares to last month
+//   - previous_year: tr a year earlier
+//   - custom: compareFrom/compareTo, in the same formats as from/to
+//
+// The comparison keeps tr's interval and timezone.
+func parseCompareRange(c *fiber.Ctx, tr TimeRange, compare string) (TimeRange, string) {
+	cr := tr
+	cr.Filter = compare
+	loc := tr.Location()
+	start, end := tr.Start.In(loc), tr.End.In(loc)
+
+	switch compare {
+	case "previous_period":
+		// shifting by calendar units keeps DST changes from moving the boundaries
+		if months, ok := wholeMonths(start, end); ok {
+			cr.Start = start.AddDate(0, -months, 0)
+		} else if days, ok := wholeDays(start, end); ok {
+			cr.Start = start.AddDate(0, 0, -days)
+		} else {
+			cr.Start = start.Add(-(end.Sub(start) + time.Millisecond))
+		}
+		cr.End = start.Add(-time.Millisecond)
+	case "previous_year":
+		cr.Start = start.AddDate(-1, 0, 0)
+		cr.End = end.AddDate(-1, 0, 0)
+	case "custom":
+		from, to := c.Query("compareFrom"), c.Query("compareTo")
+		if from == "" || to == "" {
+			return cr, "Both compareFrom and compareTo are required"
+		}
+
+		var err error
+		if cr.Start, err = parseRangeDate(from, false, loc); err != nil {
+			return cr, "Invalid compareFrom date, use YYYY-MM-DD or RFC 3339"
+		}
+		if cr.End, err = parseRangeDate(to, true, loc); err != nil {
+			return cr, "Invalid compareTo date, use YYYY-MM-DD or RFC 3339"
+		}
+		if !cr.End.After(cr.Start) {
+			return cr, "compareTo must be after compareFrom"
+		}
+		if cr.End.Sub(cr.Start)/intervals[cr.Interval] > maxBuckets {
+			return cr, "Interval too small for the comparison range"
+		}
+	default:
+		return cr, "Invalid compare provided, use previous_period, previous_year or custom"
+	}
+
+	cr.Start, cr.End = cr.Start.UTC(), cr.End.UTC()
+	return cr, ""
+}
+
+// wholeMonths reports how many calendar months a range spans when it
+// starts on the first of a month and ends on the last day of one
+func wholeMonths(start, end time.Time) (int, bool) {
+	if !start.Equal(startOfDay(start)) || start.Day() != 1 || !end.Equal(endOfMonth(end)) {
+		return 0, false
+	}
+	return (end.Year()-start.Year())*12 + int(end.Month()-start.Month()) + 1, true
+}
+
+// wholeDays reports how many days a range spans when it starts at midnight
+// and ends at the end of a day
+func wholeDays(start, end time.Time) (int, bool) {
+	if !start.Equal(startOfDay(start)) || !end.Equal(endOfDay(end)) {
+		return 0, false
+	}
+
+	days := 0
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		days++
+	}
+	return days, true
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"supametrics/db"
+	"supametrics/models"
+	"supametrics/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	deadLetterRetryInterval = time.Minute
+
+	// a replay pass holds the lease at most this long, a crashed instance
+	// can't block the others for longer
+	deadLetterLeaseTTL = 5 * time.Minute
+)
+
+// errReplayBusy is returned while another instance replays dead letters
+var errReplayBusy = errors.New("dead letters are being replayed")
+
+// saveAnalyticsEvent inserts an event, moving it to the dead-letter stream
+// when the insert fails. It only errors when the event is lost entirely.
+func saveAnalyticsEvent(event models.AnalyticsEvent) (queued bool, err error) {
+	insertErr := insertAnalyticsEvent(event)
+	if insertErr == nil {
+		return false, nil
+	}
+
+	log.Println("event insert failed, moving to dead-letter:", insertErr)
+	if err := utils.PushDeadLetter(event, insertErr); err != nil {
+		log.Println("dead-letter push failed, event lost:", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// StartDeadLetterWorker periodically retries dead-lettered events
+func StartDeadLetterWorker() {
+	go func() {
+		ticker := time.NewTicker(deadLetterRetryInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			replayed, failed, err := replayDeadLetters(500, false)
+			if err == errReplayBusy {
+				continue
+			}
+			if err != nil {
+				log.Println("dead-letter retry error:", err)
+				continue
+			}
+			if replayed > 0 || failed > 0 {
+				log.Printf("dead-letter retry: %d replayed, %d still failing", replayed, failed)
+			}
+		}
+	}()
+}
+
+// replayDeadLetters retries up to limit dead letters. Parked entries, those
+// past the max attempts, are only retried when force is set. Only one
+// instance replays at a time, the others get errReplayBusy.
+func replayDeadLetters(limit int64, force bool) (replayed, failed int, err error) {
+	release, ok := utils.AcquireDeadLetterLease(deadLetterLeaseTTL)
+	if !ok {
+		return 0, 0, errReplayBusy
+	}
+	defer release()
+
+	letters, err := utils.ListDeadLetters(limit)
+	if err != nil {
+		return 0, 0, err
+	}
+	if force {
+		parked, err := utils.ListParkedLetters(limit)
+		if err != nil {
+			return 0, 0, err
+		}
+		letters = append(letters, parked...)
+	}
+
+	for _, letter := range letters {
+		if !force && letter.Attempts >= utils.DeadLetterMaxAttempts {
+			// entries queued before the parked stream existed, move them there
+			if err := utils.RequeueDeadLetter(letter, letter.Error, letter.Attempts); err != nil {
+				log.Println("dead-letter park error:", err)
+			}
+			continue
+		}
+
+		insertErr := insertAnalyticsEvent(letter.Event)
+		if insertErr != nil && !isUniqueViolation(insertErr) {
+			failed++
+			// re-queue with the new attempt count, the old entry goes away
+			if err := utils.RequeueDeadLetter(letter, insertErr.Error(), letter.Attempts+1); err != nil {
+				log.Println("dead-letter requeue error:", err)
+			}
+			continue
+		}
+
+		// a unique violation means an earlier retry already landed
+		replayed++
+		utils.IncrementMetric("events_replayed")
+		if insertErr == nil {
+			recordReplayedIssue(letter.Event)
+		}
+		if err := utils.DeleteDeadLetter(letter); err != nil {
+			log.Println("dead-letter delete error:", err)
+		}
+	}
+
+	return replayed, failed, nil
+}
+
+// recordReplayedIssue groups a replayed error event into its issue, like
+// LogAnalyticsEvent does for events written right away. The details come
+// from the event_data the error was stored with.
+func recordReplayedIssue(event models.AnalyticsEvent) {
+	if event.EventType != "error" {
+		return
+	}
+
+	fingerprint, _ := event.EventData["fingerprint"].(string)
+	raw, err := json.Marshal(event.EventData["error"])
+	if fingerprint == "" || err != nil {
+		return
+	}
+	var details models.ErrorDetails
+	if err := json.Unmarshal(raw, &details); err != nil || details.Message == "" {
+		return
+	}
+
+	if err := recordIssue(event, &details, fingerprint); err != nil {
+		log.Println("issue upsert error:", err)
+	}
+}
+
+// GetDeadLetters lets operators inspect failed event writes, ?parked=true
+// lists the ones the worker gave up on
+func GetDeadLetters(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	list := utils.ListDeadLetters
+	if c.QueryBool("parked") {
+		list = utils.ListParkedLetters
+	}
+	letters, err := list(int64(limit))
+	if err != nil {
+		log.Println("dead-letter list error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to read dead letters"})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Dead letters fetched successfully",
+		"data":    letters,
+	})
+}
+
+// ReplayDeadLetters retries dead letters now, including parked ones
+func ReplayDeadLetters(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 500)
+	if limit < 1 || limit > 5000 {
+		limit = 500
+	}
+
+	replayed, failed, err := replayDeadLetters(int64(limit), true)
+	if err == errReplayBusy {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Dead letters are being replayed, retry shortly"})
+	}
+	if err != nil {
+		log.Println("dead-letter replay error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to replay dead letters"})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Dead letters replayed",
+		"data": fiber.Map{
+			"replayed": replayed,
+			"failed":   failed,
+		},
+	})
+}
+
+// GetMetrics reports operational counters
+func GetMetrics(c *fiber.Ctx) error {
+	pending, err := utils.CountDeadLetters()
+	if err != nil {
+		log.Println("dead-letter count error:", err)
+	}
+	parked, err := utils.CountParkedLetters()
+	if err != nil {
+		log.Println("parked dead-letter count error:", err)
+	}
+
+	stats := db.DB.Stats()
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Metrics fetched successfully",
+		"data": fiber.Map{
+			"eventsFailed":      utils.GetMetric("events_failed"),
+			"eventsRetried":     utils.GetMetric("events_retried"),
+			"eventsReplayed":    utils.GetMetric("events_replayed"),
+			"deadLetterPending": pending,
+			"deadLetterParked":  parked,
+			"dbOpenConnections": stats.OpenConnections,
+			"dbInUse":           stats.InUse,
+		},
+	})
+}
@@ -0,0 +1,430 @@
+package handlers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"supametrics/db"
+	"supametrics/middleware"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parquet-go/parquet-go"
+)
+
+type exportKind int
+
+const (
+	exportText exportKind = iota
+	exportInt
+	exportFloat
+	exportBool
+	exportTime
+	exportJSON
+)
+
+type exportColumn struct {
+	Name string
+	Kind exportKind
+}
+
+// every exportable analytics_events column, in export order
+var exportColumns = []exportColumn{
+	{"uuid", exportText}, {"project_id", exportText}, {"session_id", exportText},
+	{"visitor_id", exportText}, {"user_id", exportText}, {"timestamp", exportTime}, {"pathname", exportText},
+	{"referrer", exportText}, {"hostname", exportText}, {"utm_source", exportText},
+	{"utm_medium", exportText}, {"utm_campaign", exportText}, {"utm_term", exportText},
+	{"utm_content", exportText}, {"event_type", exportText}, {"event_name", exportText},
+	{"event_data", exportJSON}, {"country", exportText}, {"country_name", exportText},
+	{"continent", exportText}, {"region", exportText}, {"city", exportText},
+	{"postal_code", exportText}, {"latitude", exportFloat}, {"longitude", exportFloat},
+	{"timezone", exportText}, {"isp", exportText}, {"asn", exportInt},
+	{"as_organization", exportText}, {"datacenter", exportBool}, {"browser_name", exportText},
+	{"browser_version", exportText}, {"os_name", exportText}, {"os_version", exportText},
+	{"device_type", exportText}, {"device_vendor", exportText}, {"device_model", exportText},
+	{"screen_width", exportInt}, {"screen_height", exportInt}, {"screen_size", exportText},
+	{"viewport_width", exportInt}, {"language", exportText}, {"user_agent", exportText},
+	{"duration", exportInt}, {"import_id", exportText},
+}
+
+var exportContentTypes = map[string]string{
+	"ndjson":  "application/x-ndjson",
+	"csv":     "text/csv; charset=utf-8",
+	"parquet": "application/vnd.apache.parquet",
+}
+
+// rows per parquet row group, bounds what the writer holds in memory
+const exportRowGroupSize = 10000
+
+// exportWriter encodes the selected columns of one row at a time
+type exportWriter interface {
+	WriteRow(values []any) error
+	Close() error
+}
+
+// ExportEvents streams the raw events of a range as NDJSON, CSV or Parquet.
+// Rows are encoded as they are read, the result is never held in memory.
+func ExportEvents(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	tr, msg := parseTimeRange(c, ctx.ProjectID, "today")
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	eq, msg := parseEventQuery(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	format := c.Query("format", "ndjson")
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid format provided, use ndjson, csv or parquet"})
+	}
+
+	columns, msg := selectExportColumns(c.Query("columns"))
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	selected := make([]string, len(columns))
+	for i, col := range columns {
+		switch col.Kind {
+		case exportText, exportJSON:
+			// uuid and jsonb columns are read as text
+			selected[i] = col.Name + "::text"
+		default:
+			selected[i] = col.Name
+		}
+	}
+
+	where := eq.where(ctx.ProjectID, tr)
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM analytics_events
+		WHERE %s
+		ORDER BY timestamp, uuid;
+	`, strings.Join(selected, ", "), where.String())
+
+	// run the query before streaming so failures still get a status code
+	rows, err := db.DB.Query(query, where.Args()...)
+	if err != nil {
+		log.Println("Export query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error exporting events"})
+	}
+
+	filename := fmt.Sprintf("supametrics-%s-%s.%s", ctx.ProjectID, tr.Start.Format("20060102"), format)
+	compress := c.QueryBool("gzip")
+	if compress {
+		filename += ".gz"
+		contentType = "application/gzip"
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer rows.Close()
+
+		var out io.Writer = w
+		if compress {
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			out = gz
+		}
+
+		if err := streamExport(rows, columns, format, out); err != nil {
+			// the status is already sent, the client sees a truncated file
+			log.Println("Export stream error:", err)
+		}
+	})
+	return nil
+}
+
+// selectExportColumns resolves the comma separated columns parameter, all
+// columns when it is empty
+func selectExportColumns(raw string) ([]exportColumn, string) {
+	if strings.TrimSpace(raw) == "" {
+		return exportColumns, ""
+	}
+
+	byName := make(map[string]exportColumn, len(exportColumns))
+	for _, col := range exportColumns {
+		byName[col.Name] = col
+	}
+
+	var columns []exportColumn
+	seen := map[string]bool{}
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		col, ok := byName[name]
+		if !ok {
+			return nil, fmt.Sprintf("Unknown export column %q", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			columns = append(columns, col)
+		}
+	}
+	return columns, ""
+}
+
+func streamExport(rows *sql.Rows, columns []exportColumn, format string, out io.Writer) error {
+	var ew exportWriter
+	switch format {
+	case "csv":
+		ew = newCSVExportWriter(out, columns)
+	case "parquet":
+		ew = newParquetExportWriter(out, columns)
+	default:
+		ew = &ndjsonExportWriter{out: out, columns: columns}
+	}
+
+	dest := make([]any, len(columns))
+	for i, col := range columns {
+		switch col.Kind {
+		case exportInt:
+			dest[i] = new(sql.NullInt64)
+		case exportFloat:
+			dest[i] = new(sql.NullFloat64)
+		case exportBool:
+			dest[i] = new(sql.NullBool)
+		case exportTime:
+			dest[i] = new(sql.NullTime)
+		default:
+			dest[i] = new(sql.NullString)
+		}
+	}
+
+	values := make([]any, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i := range dest {
+			values[i] = nullableValue(dest[i])
+		}
+		if err := ew.WriteRow(values); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+// nullableValue unwraps a scanned sql.Null* into its value or nil
+func nullableValue(v any) any {
+	switch v := v.(type) {
+	case *sql.NullString:
+		if v.Valid {
+			return v.String
+		}
+	case *sql.NullInt64:
+		if v.Valid {
+			return v.Int64
+		}
+	case *sql.NullFloat64:
+		if v.Valid {
+			return v.Float64
+		}
+	case *sql.NullBool:
+		if v.Valid {
+			return v.Bool
+		}
+	case *sql.NullTime:
+		if v.Valid {
+			return v.Time.UTC()
+		}
+	}
+	return nil
+}
+
+type ndjsonExportWriter struct {
+	out     io.Writer
+	columns []exportColumn
+	buf     []byte
+}
+
+// WriteRow writes one JSON object per line with the keys in column order
+func (w *ndjsonExportWriter) WriteRow(values []any) error {
+	buf := append(w.buf[:0], '{')
+	for i, col := range w.columns {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendQuote(buf, col.Name)
+		buf = append(buf, ':')
+
+		switch v := values[i].(type) {
+		case nil:
+			buf = append(buf, "null"...)
+		case time.Time:
+			buf = strconv.AppendQuote(buf, v.Format(time.RFC3339Nano))
+		case string:
+			if col.Kind == exportJSON {
+				buf = append(buf, v...)
+				break
+			}
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			buf = append(buf, encoded...)
+		default:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			buf = append(buf, encoded...)
+		}
+	}
+	buf = append(buf, '}', '\n')
+	w.buf = buf
+
+	_, err := w.out.Write(buf)
+	return err
+}
+
+func (w *ndjsonExportWriter) Close() error { return nil }
+
+type csvExportWriter struct {
+	csv    *csv.Writer
+	header []string
+	record []string
+}
+
+func newCSVExportWriter(out io.Writer, columns []exportColumn) *csvExportWriter {
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.Name
+	}
+	return &csvExportWriter{csv: csv.NewWriter(out), header: header, record: make([]string, len(columns))}
+}
+
+// WriteRow writes a record, NULL becomes an empty field
+func (w *csvExportWriter) WriteRow(values []any) error {
+	if w.header != nil {
+		if err := w.csv.Write(w.header); err != nil {
+			return err
+		}
+		w.header = nil
+	}
+
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+			w.record[i] = ""
+		case string:
+			w.record[i] = v
+		case int64:
+			w.record[i] = strconv.FormatInt(v, 10)
+		case float64:
+			w.record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			w.record[i] = strconv.FormatBool(v)
+		case time.Time:
+			w.record[i] = v.Format(time.RFC3339Nano)
+		}
+	}
+	return w.csv.Write(w.record)
+}
+
+func (w *csvExportWriter) Close() error {
+	// an empty export still gets its header
+	if w.header != nil {
+		if err := w.csv.Write(w.header); err != nil {
+			return err
+		}
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+type parquetExportWriter struct {
+	writer *parquet.Writer
+	// position of each selected column among the schema's leaves, which
+	// parquet orders by name
+	leaf []int
+	row  parquet.Row
+}
+
+func newParquetExportWriter(out io.Writer, columns []exportColumn) *parquetExportWriter {
+	group := parquet.Group{}
+	for _, col := range columns {
+		var node parquet.Node
+		switch col.Kind {
+		case exportInt:
+			node = parquet.Int(64)
+		case exportFloat:
+			node = parquet.Leaf(parquet.DoubleType)
+		case exportBool:
+			node = parquet.Leaf(parquet.BooleanType)
+		case exportTime:
+			node = parquet.Timestamp(parquet.Microsecond)
+		case exportJSON:
+			node = parquet.JSON()
+		default:
+			node = parquet.String()
+		}
+		group[col.Name] = parquet.Optional(node)
+	}
+	schema := parquet.NewSchema("analytics_event", group)
+
+	index := map[string]int{}
+	for i, field := range schema.Fields() {
+		index[field.Name()] = i
+	}
+	leaf := make([]int, len(columns))
+	for i, col := range columns {
+		leaf[i] = index[col.Name]
+	}
+
+	return &parquetExportWriter{
+		writer: parquet.NewWriter(out, schema,
+			parquet.Compression(&parquet.Snappy),
+			parquet.MaxRowsPerRowGroup(exportRowGroupSize),
+		),
+		leaf: leaf,
+		row:  make(parquet.Row, len(columns)),
+	}
+}
+
+func (w *parquetExportWriter) WriteRow(values []any) error {
+	for i, value := range values {
+		var v parquet.Value
+		switch value := value.(type) {
+		case nil:
+			w.row[w.leaf[i]] = parquet.NullValue().Level(0, 0, w.leaf[i])
+			continue
+		case string:
+			v = parquet.ByteArrayValue([]byte(value))
+		case int64:
+			v = parquet.Int64Value(value)
+		case float64:
+			v = parquet.DoubleValue(value)
+		case bool:
+			v = parquet.BooleanValue(value)
+		case time.Time:
+			v = parquet.Int64Value(value.UnixMicro())
+		}
+		w.row[w.leaf[i]] = v.Level(0, 1, w.leaf[i])
+	}
+	_, err := w.writer.WriteRows([]parquet.Row{w.row})
+	return err
+}
+
+func (w *parquetExportWriter) Close() error {
+	return w.writer.Close()
+}
@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+const (
+	maxFilters     = 20
+	maxFilterValue = 100
+)
+
+// event columns a filter can target, numeric and boolean ones are
+// compared as text
+var filterColumns = map[string]string{
+	"session_id":      "session_id",
+	"visitor_id":      "visitor_id",
+	"user_id":         "user_id",
+	"pathname":        "pathname",
+	"referrer":        "referrer",
+	"hostname":        "hostname",
+	"utm_source":      "utm_source",
+	"utm_medium":      "utm_medium",
+	"utm_campaign":    "utm_campaign",
+	"utm_term":        "utm_term",
+	"utm_content":     "utm_content",
+	"event_type":      "event_type",
+	"event_name":      "event_name",
+	"country":         "country",
+	"country_name":    "country_name",
+	"continent":       "continent",
+	"region":          "region",
+	"city":            "city",
+	"postal_code":     "postal_code",
+	"timezone":        "timezone",
+	"isp":             "isp",
+	"asn":             "asn::text",
+	"as_organization": "as_organization",
+	"datacenter":      "datacenter::text",
+	"browser_name":    "browser_name",
+	"browser_version": "browser_version",
+	"os_name":         "os_name",
+	"os_version":      "os_version",
+	"device_type":     "device_type",
+	"device_vendor":   "device_vendor",
+	"device_model":    "device_model",
+	"user_agent":      "user_agent",
+	"screen_width":    "screen_width::text",
+	"screen_height":   "screen_height::text",
+	"screen_size":     "screen_size",
+	"viewport_width":  "viewport_width::text",
+	"language":        "language",
+	"duration":        "duration::text",
+}
+
+// filter operators, the "!" forms match rows without a value too
+var filterOperators = map[string]bool{
+	"==": true, // equals, "a|b" for any of several values, empty for no value
+	"!=": true,
+	"=@": true, // contains
+	"!@": true,
+	"=^": true, // starts with
+	"!^": true,
+	"=~": true, // matches a regular expression
+	"!~": true,
+}
+
+var (
+	filterFieldPattern = regexp.MustCompile(`^[a-z_]+$`)
+	filterKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// EventFilter is one condition of the filters parameter, e.g. country==NG
+type EventFilter struct {
+	Field    string
+	Operator string
+	Values   []string
+	// key path into event_data for event_data.* fields
+	path []string
+}
+
+// EventQuery holds the event conditions shared by the read endpoints
+type EventQuery struct {
+	EventName         string
+	ExcludeDatacenter bool
+	Filters           []EventFilter
+}
+
+// whereBuilder collects AND-ed SQL conditions with their positional
+// arguments, values never end up in the SQL text
+type whereBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+// add appends a condition, each %s in it is replaced by the placeholder
+// of the matching value
+func (w *whereBuilder) add(condition string, values ...interface{}) {
+	placeholders := make([]interface{}, len(values))
+	for i, value := range values {
+		w.args = append(w.args, value)
+		placeholders[i] = fmt.Sprintf("$%d", len(w.args))
+	}
+	w.conditions = append(w.conditions, fmt.Sprintf(condition, placeholders...))
+}
+
+// group builds conditions with build and returns them AND-ed in
+// parentheses, without adding them to w. Their arguments are bound to w.
+func (w *whereBuilder) group(build func(*whereBuilder)) string {
+	sub := &whereBuilder{args: w.args}
+	build(sub)
+	w.args = sub.args
+	if len(sub.conditions) == 0 {
+		return "TRUE"
+	}
+	return "(" + sub.String() + ")"
+}
+
+func (w *whereBuilder) String() string {
+	return strings.Join(w.conditions, " AND ")
+}
+
+func (w *whereBuilder) Args() []interface{} {
+	return w.args
+}
+
+// parseEventQuery reads eventName, excludeDatacenter and filters from the
+// request. The returned message is empty when they are valid.
+func parseEventQuery(c *fiber.Ctx) (EventQuery, string) {
+	q := EventQuery{
+		EventName:         c.Query("eventName", c.Params("eventName")),
+		ExcludeDatacenter: c.QueryBool("excludeDatacenter"),
+	}
+
+	filters, msg := parseFilters(c.Query("filters"))
+	if msg != "" {
+		return q, msg
+	}
+	q.Filters = filters
+	return q, ""
+}
+
+// where builds the conditions selecting the events of a project in a range
+func (q EventQuery) where(projectID string, tr TimeRange) *whereBuilder {
+	w := &whereBuilder{}
+	w.add("project_id = %s", projectID)
+	w.add("timestamp >= %s AND timestamp <= %s", tr.Start, tr.End)
+	q.apply(w)
+	return w
+}
+
+// apply adds the event name, datacenter and filter conditions of q to w
+func (q EventQuery) apply(w *whereBuilder) {
+	if q.EventName != "" {
+		w.add("event_name = %s", q.EventName)
+	}
+	// drops cloud and hosting traffic
+	if q.ExcludeDatacenter {
+		w.add("NOT datacenter")
+	}
+	for _, f := range q.Filters {
+		f.apply(w)
+	}
+}
+
+// isEmpty reports whether q matches every event
+func (q EventQuery) isEmpty() bool {
+	return q.EventName == "" && !q.ExcludeDatacenter && len(q.Filters) == 0
+}
+
+// parseFilters parses conditions separated by ";" such as
+// country==NG;pathname=^/blog;event_data.plan==pro. A backslash escapes
+// ";", "|" and itself in values.
+func parseFilters(raw string) ([]EventFilter, string) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, ""
+	}
+
+	parts := splitEscaped(raw, ';')
+	if len(parts) > maxFilters {
+		return nil, fmt.Sprintf("Too many filters, at most %d are allowed", maxFilters)
+	}
+
+	filters := make([]EventFilter, 0, len(parts))
+	for _, part := range parts {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		f, msg := parseFilter(part)
+		if msg != "" {
+			return nil, msg
+		}
+		filters = append(filters, f)
+	}
+	return filters, ""
+}
+
+func parseFilter(raw string) (EventFilter, string) {
+	i := strings.IndexAny(raw, "=!")
+	if i < 1 || i+2 > len(raw) || !filterOperators[raw[i:i+2]] {
+		return EventFilter{}, fmt.Sprintf("Invalid filter %q, use field, operator and value like country==NG", raw)
+	}
+
+	f := EventFilter{Field: strings.TrimSpace(raw[:i]), Operator: raw[i : i+2]}
+	value := raw[i+2:]
+
+	if key, ok := strings.CutPrefix(f.Field, "event_data."); ok {
+		f.path = strings.Split(key, ".")
+		for _, segment := range f.path {
+			if !filterKeyPattern.MatchString(segment) {
+				return f, fmt.Sprintf("Invalid event_data key in filter %q", raw)
+			}
+		}
+	} else if !filterFieldPattern.MatchString(f.Field) || filterColumns[f.Field] == "" {
+		return f, fmt.Sprintf("Unknown filter field %q", f.Field)
+	}
+
+	// only equality takes several values, "|" is alternation in a regex
+	if f.Operator == "==" || f.Operator == "!=" {
+		for _, v := range splitEscaped(value, '|') {
+			f.Values = append(f.Values, unescapeFilterValue(v))
+		}
+	} else {
+		f.Values = []string{unescapeFilterValue(value)}
+		if f.Values[0] == "" {
+			return f, fmt.Sprintf("Filter %q needs a value", raw)
+		}
+	}
+
+	if len(f.Values) > maxFilterValue {
+		return f, fmt.Sprintf("Filter %q has too many values, at most %d are allowed", raw, maxFilterValue)
+	}
+	if f.Operator == "=~" || f.Operator == "!~" {
+		if !portableRegex(f.Values[0]) {
+			return f, fmt.Sprintf("Invalid regular expression in filter %q, "+
+				`flags, named groups and \z, \p, \Q or \C escapes are not supported`, raw)
+		}
+	}
+	return f, ""
+}
+
+// apply adds the condition of the filter to w
+func (f EventFilter) apply(w *whereBuilder) {
+	var expr string
+	var args []interface{}
+	if f.path != nil {
+		expr = "event_data #>> %s"
+		args = append(args, pq.Array(f.path))
+	} else {
+		expr = filterColumns[f.Field]
+	}
+
+	negated := f.Operator[0] == '!'
+	var condition string
+	switch f.Operator {
+	case "==", "!=":
+		switch {
+		case len(f.Values) == 1 && f.Values[0] == "":
+			// an empty value matches events without one
+			condition = expr + " IS NULL"
+			if negated {
+				condition = expr + " IS NOT NULL"
+			}
+			w.add(condition, args...)
+			return
+		case len(f.Values) == 1:
+			condition = expr + " = %s"
+			args = append(args, f.Values[0])
+		default:
+			condition = expr + " = ANY(%s)"
+			args = append(args, pq.Array(f.Values))
+		}
+	case "=@", "!@":
+		condition = "strpos(" + expr + ", %s) > 0"
+		args = append(args, f.Values[0])
+	case "=^", "!^":
+		condition = "starts_with(" + expr + ", %s)"
+		args = append(args, f.Values[0])
+	case "=~", "!~":
+		condition = expr + " ~ %s"
+		args = append(args, f.Values[0])
+	}
+
+	if negated {
+		// the path argument is used twice, so it is bound twice
+		if f.path != nil {
+			args = append([]interface{}{pq.Array(f.path)}, args...)
+		}
+		condition = "(" + expr + " IS NULL OR NOT " + condition + ")"
+	}
+	w.add(condition, args...)
+}
+
+// portableRegex reports whether pattern means the same to Go, which
+// validates it, and to Postgres, which runs it. Go only syntax like (?P<x>)
+// or \z, and repetitions Postgres caps at 255, would fail the query.
+func portableRegex(pattern string) bool {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return false
+	}
+
+	for i := 0; i < len(pattern)-1; i++ {
+		switch {
+		case pattern[i] == '\\':
+			if strings.IndexByte("zpPQEC", pattern[i+1]) >= 0 {
+				return false
+			}
+			i++
+		case pattern[i] == '(' && pattern[i+1] == '?':
+			// only non-capturing groups, flags and names are Go syntax
+			if i+2 >= len(pattern) || pattern[i+2] != ':' {
+				return false
+			}
+		}
+	}
+
+	var repeatsOK func(re *syntax.Regexp) bool
+	repeatsOK = func(re *syntax.Regexp) bool {
+		if re.Op == syntax.OpRepeat && (re.Min > 255 || re.Max > 255) {
+			return false
+		}
+		for _, sub := range re.Sub {
+			if !repeatsOK(sub) {
+				return false
+			}
+		}
+		return true
+	}
+	return repeatsOK(re)
+}
+
+// splitEscaped splits s on sep unless it is preceded by a backslash, the
+// escapes are kept for unescapeFilterValue
+func splitEscaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unescapeFilterValue(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"supametrics/db"
+	"supametrics/middleware"
+	"supametrics/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	minFunnelSteps  = 2
+	maxFunnelSteps  = 10
+	maxFunnelWindow = 90 * 24 * time.Hour
+)
+
+// columns a funnel follows its actors by
+var funnelActors = map[string]string{
+	"visitor": "visitor_id",
+	"session": "session_id",
+}
+
+type FunnelStepResult struct {
+	Step               int      `json:"step"`
+	Name               string   `json:"name"`
+	Count              int      `json:"count"`
+	ConversionRate     float64  `json:"conversionRate"`     // of the first step
+	StepConversionRate float64  `json:"stepConversionRate"` // of the previous step
+	DropOff            int      `json:"dropOff"`
+	DropOffRate        float64  `json:"dropOffRate"`
+	MedianSeconds      *float64 `json:"medianSeconds"` // from the previous step
+}
+
+// funnelStep is a validated step with its parsed filters
+type funnelStep struct {
+	models.FunnelStep
+	filters []EventFilter
+}
+
+// PostFunnel computes how many visitors or sessions go through an ordered
+// list of steps within a conversion window
+func PostFunnel(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	var req models.FunnelRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid payload"})
+	}
+
+	steps, window, msg := validateFunnelRequest(&req)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	tr, msg := parseTimeRange(c, ctx.ProjectID, "last30d")
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	eq, msg := parseEventQuery(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	query, args := funnelQuery(eq.where(ctx.ProjectID, tr), steps, funnelActors[req.CountBy], req.Order == "strict", window)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		log.Println("Funnel query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error computing funnel"})
+	}
+	defer rows.Close()
+
+	results := make([]FunnelStepResult, len(steps))
+	for rows.Next() {
+		var step, count int
+		var median sql.NullFloat64
+		if err := rows.Scan(&step, &count, &median); err != nil {
+			log.Println("Error scanning funnel row:", err)
+			continue
+		}
+		if step < 1 || step > len(steps) {
+			continue
+		}
+		results[step-1].Count = count
+		if median.Valid {
+			results[step-1].MedianSeconds = &median.Float64
+		}
+	}
+
+	for i := range results {
+		r := &results[i]
+		r.Step = i + 1
+		r.Name = steps[i].Name
+
+		first, previous := results[0].Count, results[0].Count
+		if i > 0 {
+			previous = results[i-1].Count
+		}
+		r.ConversionRate = percentage(r.Count, first)
+		r.StepConversionRate = percentage(r.Count, previous)
+		r.DropOff = previous - r.Count
+		r.DropOffRate = percentage(r.DropOff, previous)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Funnel computed successfully",
+		"data": fiber.Map{
+			"projectId":      ctx.ProjectID,
+			"filter":         tr.Filter,
+			"from":           tr.Start,
+			"to":             tr.End,
+			"order":          req.Order,
+			"window":         int(window.Seconds()),
+			"countBy":        req.CountBy,
+			"conversionRate": results[len(results)-1].ConversionRate,
+			"steps":          results,
+		},
+	})
+}
+
+// validateFunnelRequest fills in the defaults of req and checks its steps.
+// The returned message is empty when the request is valid.
+func validateFunnelRequest(req *models.FunnelRequest) ([]funnelStep, time.Duration, string) {
+	if len(req.Steps) < minFunnelSteps || len(req.Steps) > maxFunnelSteps {
+		return nil, 0, fmt.Sprintf("A funnel needs %d to %d steps", minFunnelSteps, maxFunnelSteps)
+	}
+
+	if req.Order == "" {
+		req.Order = "loose"
+	}
+	if req.Order != "loose" && req.Order != "strict" {
+		return nil, 0, "Invalid order provided, use loose or strict"
+	}
+
+	if req.CountBy == "" {
+		req.CountBy = "visitor"
+	}
+	if _, ok := funnelActors[req.CountBy]; !ok {
+		return nil, 0, "Invalid count_by provided, use visitor or session"
+	}
+
+	if req.Window == "" {
+		req.Window = "24h"
+	}
+	window, err := parseWindow(req.Window)
+	if err != nil || window <= 0 || window > maxFunnelWindow {
+		return nil, 0, "Invalid window provided, use a duration like 30m, 24h or 7d of at most 90d"
+	}
+
+	steps := make([]funnelStep, len(req.Steps))
+	for i, s := range req.Steps {
+		if s.Name == "" {
+			s.Name = fmt.Sprintf("Step %d", i+1)
+		}
+		if (s.EventName == nil || *s.EventName == "") && (s.Pathname == nil || *s.Pathname == "") && s.Filters == "" {
+			return nil, 0, fmt.Sprintf("Step %d needs an event_name, pathname or filters", i+1)
+		}
+
+		filters, msg := parseFilters(s.Filters)
+		if msg != "" {
+			return nil, 0, fmt.Sprintf("Step %d: %s", i+1, msg)
+		}
+		steps[i] = funnelStep{FunnelStep: s, filters: filters}
+	}
+	return steps, window, ""
+}
+
+// parseWindow parses a Go duration, or a number of days like "7d"
+func parseWindow(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// condition matches the events of the step
+func (s funnelStep) condition(w *whereBuilder) string {
+	return w.group(func(sub *whereBuilder) {
+		if s.EventName != nil && *s.EventName != "" {
+			sub.add("event_name = %s", *s.EventName)
+		}
+		if s.Pathname != nil && *s.Pathname != "" {
+			sub.add(`pathname LIKE %s ESCAPE '\'`, globToLike(*s.Pathname))
+		}
+		for _, f := range s.filters {
+			f.apply(sub)
+		}
+	})
+}
+
+// globToLike turns a pathname pattern where "*" matches any characters
+// into a LIKE pattern
+func globToLike(glob string) string {
+	var b strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '%', '_', '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case '*':
+			b.WriteRune('%')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// funnelQuery numbers the events of each actor, then follows a path from
+// every match of step 1 to the earliest later match of each next step.
+// Strict funnels only accept the very next event. Each actor counts with
+// their best path, the one going furthest, and the earliest of those. It
+// returns one row per step with the actors that reached it and the median
+// seconds since the previous step.
+func funnelQuery(where *whereBuilder, steps []funnelStep, actor string, strict bool, window time.Duration) (string, []interface{}) {
+	where.add(actor + " IS NOT NULL")
+
+	flags := make([]string, len(steps))
+	for i, s := range steps {
+		flags[i] = fmt.Sprintf("%s AS m%d", s.condition(where), i+1)
+	}
+
+	// loose funnels ignore events that match no step
+	ev := "SELECT *, ROW_NUMBER() OVER (PARTITION BY actor ORDER BY timestamp, uuid) AS rn FROM flagged"
+	if !strict {
+		matched := make([]string, len(steps))
+		for i := range steps {
+			matched[i] = fmt.Sprintf("m%d", i+1)
+		}
+		ev += " WHERE " + strings.Join(matched, " OR ")
+	}
+
+	ctes := []string{
+		fmt.Sprintf(`flagged AS (
+			SELECT %s AS actor, timestamp, uuid, %s
+			FROM analytics_events
+			WHERE %s
+		)`, actor, strings.Join(flags, ", "), where.String()),
+		fmt.Sprintf("ev AS (%s)", ev),
+		`s1 AS (
+			SELECT actor, rn AS start, timestamp AS t1, rn, timestamp AS t, NULL::double precision AS dt
+			FROM ev
+			WHERE m1
+		)`,
+	}
+
+	next := "e.rn > s.rn"
+	if strict {
+		next = "e.rn = s.rn + 1"
+	}
+	depths := []string{"SELECT actor, start, 1 AS depth FROM s1"}
+	for i := 2; i <= len(steps); i++ {
+		ctes = append(ctes, fmt.Sprintf(`s%d AS (
+			SELECT DISTINCT ON (s.actor, s.start)
+				s.actor, s.start, s.t1, e.rn, e.timestamp AS t,
+				EXTRACT(EPOCH FROM e.timestamp - s.t)::double precision AS dt
+			FROM s%d s
+			JOIN ev e ON e.actor = s.actor AND e.m%d AND %s
+				AND e.timestamp <= s.t1 + interval '%d seconds'
+			ORDER BY s.actor, s.start, e.rn
+		)`, i, i-1, i, next, int(window.Seconds())))
+		depths = append(depths, fmt.Sprintf("SELECT actor, start, %d FROM s%d", i, i))
+	}
+
+	// an actor that reached a step on any path did so on their best path
+	ctes = append(ctes, fmt.Sprintf(`best AS (
+			SELECT DISTINCT ON (actor) actor, start
+			FROM (%s) paths
+			ORDER BY actor, depth DESC, start
+		)`, strings.Join(depths, " UNION ALL ")))
+
+	results := []string{"SELECT 1 AS step, COUNT(*), NULL::double precision FROM s1 JOIN best USING (actor, start)"}
+	for i := 2; i <= len(steps); i++ {
+		results = append(results, fmt.Sprintf(
+			"SELECT %d, COUNT(*), percentile_cont(0.5) WITHIN GROUP (ORDER BY dt) FROM s%d JOIN best USING (actor, start)", i, i))
+	}
+
+	query := fmt.Sprintf("WITH %s\n%s\nORDER BY step;",
+		strings.Join(ctes, ",\n"), strings.Join(results, "\nUNION ALL\n"))
+	return query, where.Args()
+}
+
+// percentage rounds part/total to two decimals, 0 when total is 0
+func percentage(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)*10000/float64(total)) / 100
+}
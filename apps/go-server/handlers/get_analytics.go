@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 	"supametrics/db"
 	"supametrics/middleware"
 	"time"
@@ -11,69 +12,6 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-var allowedFilters = []string{
-	"today",
-	"yesterday",
-	"thisweek",
-	"thismonth",
-	"thisyear",
-}
-
-func getTimeRange(filter string) (time.Time, time.Time, string) {
-	now := time.Now().UTC()
-	var startTime, endTime time.Time
-	var bucketFormat string
-
-	startOfDay := func(t time.Time) time.Time {
-		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
-	}
-	endOfDay := func(t time.Time) time.Time {
-		return time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 999000000, time.UTC)
-	}
-
-	switch filter {
-	case "today":
-		startTime = startOfDay(now)
-		endTime = endOfDay(now)
-		bucketFormat = "hour"
-	case "yesterday":
-		y := now.AddDate(0, 0, -1)
-		startTime = startOfDay(y)
-		endTime = endOfDay(y)
-		bucketFormat = "hour"
-	case "thisweek":
-		// Assumes Monday start (common in analytics)
-		weekday := now.Weekday()
-		daysToMonday := int(weekday - time.Monday)
-		if daysToMonday < 0 {
-			daysToMonday += 7
-		}
-		startTime = startOfDay(now.AddDate(0, 0, -daysToMonday))
-		endTime = endOfDay(now.AddDate(0, 0, 6-daysToMonday))
-		bucketFormat = "day"
-	case "thismonth":
-		startTime = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
-		endTime = endOfMonth(now)
-		bucketFormat = "day"
-	case "thisyear":
-		startTime = time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
-		endTime = endOfYear(now)
-		bucketFormat = "month"
-	default: // Fallback to today
-		return getTimeRange("today")
-	}
-	return startTime, endTime, bucketFormat
-}
-
-func endOfMonth(t time.Time) time.Time {
-	y, m, _ := t.Date()
-	return time.Date(y, m+1, 0, 23, 59, 59, 999000000, time.UTC)
-}
-
-func endOfYear(t time.Time) time.Time {
-	return time.Date(t.Year(), time.December, 31, 23, 59, 59, 999000000, time.UTC)
-}
-
 type AnalyticsSummary struct {
 	TotalVisits    int `json:"totalVisits"`
 	UniqueVisitors int `json:"uniqueVisitors"`
@@ -92,34 +30,122 @@ func GetAnalytics(c *fiber.Ctx) error {
 	}
 
 	projectID := ctx.ProjectID
-	filter := c.Query("filter", "today")
-	eventName := c.Query("eventName")
-
-	// Validate filter
-	isValidFilter := false
-	for _, f := range allowedFilters {
-		if f == filter {
-			isValidFilter = true
-			break
+
+	tr, msg := parseTimeRange(c, projectID, "today")
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	eq, msg := parseEventQuery(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	var compareRange *TimeRange
+	if compare := c.Query("compare"); compare != "" {
+		cr, msg := parseCompareRange(c, tr, compare)
+		if msg != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
 		}
+		compareRange = &cr
 	}
-	if !isValidFilter {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid filter provided",
-		})
+
+	summary, frequencyData, msg := queryAnalytics(projectID, tr, eq)
+	if msg != "" {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": msg})
 	}
 
-	startTime, endTime, bucketFormat := getTimeRange(filter)
+	// the session block costs extra queries over the whole range, clients
+	// that don't show it can skip them with exclude=sessions
+	withSessions := !queryListHas(c, "exclude", "sessions")
 
-	// Build the base WHERE clause
-	whereClause := "project_id = $1 AND timestamp >= $2 AND timestamp <= $3"
-	queryArgs := []interface{}{projectID, startTime, endTime}
+	var sessions SessionSummary
+	if withSessions {
+		sessions, msg = querySessions(projectID, tr, eq, true)
+		if msg != "" {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": msg})
+		}
+	}
 
-	if eventName != "" {
-		whereClause += " AND event_name = $4"
-		queryArgs = append(queryArgs, eventName)
+	data := fiber.Map{
+		"projectId":      projectID,
+		"filter":         tr.Filter,
+		"from":           tr.Start,
+		"to":             tr.End,
+		"interval":       tr.Interval,
+		"timezone":       tr.Timezone,
+		"eventName":      eq.EventName,
+		"totalVisits":    summary.TotalVisits,
+		"uniqueVisitors": summary.UniqueVisitors,
+		"frequency":      frequencyData,
+	}
+	if withSessions {
+		data["sessions"] = sessions
 	}
 
+	if compareRange != nil {
+		compareSummary, compareFrequency, msg := queryAnalytics(projectID, *compareRange, eq)
+		if msg != "" {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": msg})
+		}
+
+		// both series get every bucket so they line up by index
+		frequencyData = tr.fillBuckets(frequencyData)
+		compareFrequency = compareRange.alignBuckets(compareRange.fillBuckets(compareFrequency), len(frequencyData))
+
+		data["frequency"] = frequencyData
+		comparison := fiber.Map{
+			"compare":        compareRange.Filter,
+			"from":           compareRange.Start,
+			"to":             compareRange.End,
+			"totalVisits":    compareSummary.TotalVisits,
+			"uniqueVisitors": compareSummary.UniqueVisitors,
+			"frequency":      compareFrequency,
+		}
+		deltas := fiber.Map{
+			"totalVisits":    newDelta(summary.TotalVisits, compareSummary.TotalVisits),
+			"uniqueVisitors": newDelta(summary.UniqueVisitors, compareSummary.UniqueVisitors),
+		}
+
+		if withSessions {
+			compareSessions, msg := querySessions(projectID, *compareRange, eq, false)
+			if msg != "" {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": msg})
+			}
+			comparison["sessions"] = compareSessions
+			deltas["totalSessions"] = newDelta(sessions.TotalSessions, compareSessions.TotalSessions)
+		}
+
+		data["comparison"] = comparison
+		data["deltas"] = deltas
+	}
+
+	// 4. Return the consolidated response
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Analytics fetched successfully",
+		"data":    data,
+	})
+}
+
+// queryListHas reports whether the comma separated query parameter key
+// lists value
+func queryListHas(c *fiber.Ctx, key, value string) bool {
+	for _, item := range strings.Split(c.Query(key), ",") {
+		if strings.TrimSpace(item) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// queryAnalytics fetches the totals and time series of a range. Errors are
+// logged, the returned message is meant for the client.
+func queryAnalytics(projectID string, tr TimeRange, eq EventQuery) (AnalyticsSummary, []FrequencyData, string) {
+	// Build the base WHERE clause
+	where := eq.where(projectID, tr)
+	whereClause, queryArgs := where.String(), where.Args()
+
 	// 2. Fetch Aggregations (Total Visits and Unique Visitors)
 	summaryQuery := fmt.Sprintf(`
 		SELECT 
@@ -133,25 +159,25 @@ func GetAnalytics(c *fiber.Ctx) error {
 	err := db.DB.QueryRow(summaryQuery, queryArgs...).Scan(&summary.TotalVisits, &summary.UniqueVisitors)
 	if err != nil && err != sql.ErrNoRows {
 		log.Println("Analytics summary query error:", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error fetching summary"})
+		return summary, nil, "Database error fetching summary"
 	}
 
 	// 3. Fetch Time-Series Frequency Data (Frequency)
 	frequencyQuery := fmt.Sprintf(`
 		SELECT 
-			date_trunc('%s', timestamp) AS time_bucket,
+			%s AS time_bucket,
 			COUNT(*) AS total_visits, 
 			COUNT(DISTINCT visitor_id) AS unique_visitors 
 		FROM analytics_events 
 		WHERE %s 
 		GROUP BY time_bucket 
 		ORDER BY time_bucket;
-	`, bucketFormat, whereClause)
+	`, tr.bucketSQL("timestamp"), whereClause)
 
 	rows, err := db.DB.Query(frequencyQuery, queryArgs...)
 	if err != nil {
 		log.Println("Analytics frequency query error:", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error fetching frequency"})
+		return summary, nil, "Database error fetching frequency"
 	}
 	defer rows.Close()
 
@@ -162,20 +188,14 @@ func GetAnalytics(c *fiber.Ctx) error {
 			log.Println("Error scanning frequency row:", err)
 			continue
 		}
+		fd.Time = fd.Time.In(tr.Location())
 		frequencyData = append(frequencyData, fd)
 	}
 
-	// 4. Return the consolidated response
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Analytics fetched successfully",
-		"data": fiber.Map{
-			"projectId":      projectID,
-			"filter":         filter,
-			"eventName":      eventName,
-			"totalVisits":    summary.TotalVisits,
-			"uniqueVisitors": summary.UniqueVisitors,
-			"frequency":      frequencyData,
-		},
-	})
+	// imported stats only hold pageview aggregates without dimensions
+	if eq.EventName == "" && len(eq.Filters) == 0 {
+		frequencyData = mergeImportedStats(projectID, tr, &summary, frequencyData)
+	}
+
+	return summary, frequencyData, ""
 }
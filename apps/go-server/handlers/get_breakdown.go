@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"supametrics/db"
+	"supametrics/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// columns the breakdown endpoint can group by, keyed by dimension name
+var breakdownDimensions = map[string]string{
+	"pathname":        "pathname",
+	"referrer":        "referrer",
+	"hostname":        "hostname",
+	"country":         "country",
+	"region":          "region",
+	"city":            "city",
+	"continent":       "continent",
+	"language":        "language",
+	"browser_name":    "browser_name",
+	"browser_version": "browser_version",
+	"os_name":         "os_name",
+	"os_version":      "os_version",
+	"device_type":     "device_type",
+	"device_vendor":   "device_vendor",
+	"device_model":    "device_model",
+	"screen_size":     "screen_size",
+	"utm_source":      "utm_source",
+	"utm_medium":      "utm_medium",
+	"utm_campaign":    "utm_campaign",
+	"utm_term":        "utm_term",
+	"utm_content":     "utm_content",
+}
+
+var breakdownSortColumns = map[string]string{
+	"visits":  "visits",
+	"uniques": "uniques",
+}
+
+type BreakdownRow struct {
+	// nil when events have no value, e.g. direct traffic for referrer
+	Value          *string `json:"value"`
+	TotalVisits    int     `json:"totalVisits"`
+	UniqueVisitors int     `json:"uniqueVisitors"`
+	Share          float64 `json:"share"` // percentage of the range's visits
+}
+
+// GetBreakdown lists the top values of a dimension with their visits,
+// unique visitors and share of all visits in the range
+func GetBreakdown(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	dimension := c.Params("dimension")
+	column, ok := breakdownDimensions[dimension]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid dimension provided"})
+	}
+
+	sortColumn, ok := breakdownSortColumns[c.Query("sort", "visits")]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid sort provided, use visits or uniques"})
+	}
+
+	tr, msg := parseTimeRange(c, ctx.ProjectID, "today")
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	p, msg := parsePage(c, ctx.ProjectID, 10, 200)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	eq, msg := parseEventQuery(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+	where := eq.where(ctx.ProjectID, tr)
+
+	// window sums run before LIMIT, so shares are of every value
+	query := fmt.Sprintf(`
+		SELECT
+			%s AS value,
+			COUNT(*) AS visits,
+			COUNT(DISTINCT visitor_id) AS uniques,
+			ROUND(COUNT(*) * 100.0 / SUM(COUNT(*)) OVER (), 2) AS share
+		FROM analytics_events
+		WHERE %s
+		GROUP BY value
+		ORDER BY %s DESC, value
+		LIMIT %d OFFSET %d;
+	`, column, where.String(), sortColumn, p.Limit+1, p.Cursor.Offset)
+
+	rows, err := db.DB.Query(query, where.Args()...)
+	if err != nil {
+		log.Println("Breakdown query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error fetching breakdown"})
+	}
+	defer rows.Close()
+
+	breakdown := []BreakdownRow{}
+	for rows.Next() {
+		var row BreakdownRow
+		if err := rows.Scan(&row.Value, &row.TotalVisits, &row.UniqueVisitors, &row.Share); err != nil {
+			log.Println("Error scanning breakdown row:", err)
+			continue
+		}
+		breakdown = append(breakdown, row)
+	}
+
+	nextCursor := p.nextOffset(len(breakdown))
+	if nextCursor != nil {
+		breakdown = breakdown[:p.Limit]
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Breakdown fetched successfully",
+		"data": fiber.Map{
+			"projectId":  ctx.ProjectID,
+			"dimension":  dimension,
+			"filter":     tr.Filter,
+			"from":       tr.Start,
+			"to":         tr.End,
+			"eventName":  eq.EventName,
+			"breakdown":  breakdown,
+			"nextCursor": nextCursor,
+		},
+	})
+}
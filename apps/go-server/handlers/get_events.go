@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"supametrics/db"
+	"supametrics/middleware"
+	"supametrics/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const eventColumns = `
+	id, uuid, project_id, session_id, visitor_id, user_id, timestamp, pathname,
+	referrer, hostname, utm_source, utm_medium, utm_campaign, utm_term, utm_content,
+	country, country_name, continent, city, region, postal_code, latitude, longitude,
+	timezone, isp, asn, as_organization, datacenter, event_type, event_name, event_data,
+	browser_name, browser_version, os_name, os_version, device_type, device_vendor,
+	device_model, screen_width, screen_height, screen_size, viewport_width, language,
+	user_agent, duration, import_id
+`
+
+func scanEvent(row interface{ Scan(...any) error }, event *models.AnalyticsEvent) error {
+	var eventData []byte
+	err := row.Scan(
+		&event.ID, &event.UUID, &event.ProjectID, &event.SessionID, &event.VisitorID,
+		&event.UserID, &event.Timestamp, &event.Pathname, &event.Referrer, &event.Hostname,
+		&event.UTMSource, &event.UTMMedium, &event.UTMCampaign, &event.UTMTerm, &event.UTMContent,
+		&event.Country, &event.CountryName, &event.Continent, &event.City, &event.Region,
+		&event.PostalCode, &event.Latitude, &event.Longitude, &event.Timezone, &event.ISP,
+		&event.ASN, &event.ASOrganization, &event.Datacenter, &event.EventType, &event.EventName,
+		&eventData, &event.BrowserName, &event.BrowserVersion, &event.OSName, &event.OSVersion,
+		&event.DeviceType, &event.DeviceVendor, &event.DeviceModel, &event.ScreenWidth,
+		&event.ScreenHeight, &event.ScreenSize, &event.ViewportWidth, &event.Language,
+		&event.UserAgent, &event.Duration, &event.ImportID,
+	)
+	if err != nil {
+		return err
+	}
+	if len(eventData) > 0 {
+		return json.Unmarshal(eventData, &event.EventData)
+	}
+	return nil
+}
+
+// GetEvents lists the raw events of a project, newest first unless
+// order=asc. Pages are keyed on (timestamp, uuid) so they stay stable
+// while new events arrive.
+func GetEvents(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	tr, msg := parseTimeRange(c, ctx.ProjectID, "today")
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	eq, msg := parseEventQuery(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	order := c.Query("order", "desc")
+	if order != "asc" && order != "desc" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid order provided, use asc or desc"})
+	}
+
+	p, msg := parsePage(c, ctx.ProjectID, 100, 1000)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	where := eq.where(ctx.ProjectID, tr)
+	if p.Cursor.Timestamp != nil {
+		if order == "asc" {
+			where.add("(timestamp, uuid) > (%s, %s)", *p.Cursor.Timestamp, *p.Cursor.UUID)
+		} else {
+			where.add("(timestamp, uuid) < (%s, %s)", *p.Cursor.Timestamp, *p.Cursor.UUID)
+		}
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM analytics_events
+		WHERE %s
+		ORDER BY timestamp %s, uuid %s
+		LIMIT %d;
+	`, eventColumns, where.String(), order, order, p.Limit+1)
+
+	rows, err := db.DB.Query(query, where.Args()...)
+	if err != nil {
+		log.Println("Events query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error fetching events"})
+	}
+	defer rows.Close()
+
+	events := []models.AnalyticsEvent{}
+	for rows.Next() {
+		var event models.AnalyticsEvent
+		if err := scanEvent(rows, &event); err != nil {
+			log.Println("Error scanning event row:", err)
+			continue
+		}
+		events = append(events, event)
+	}
+
+	var nextCursor *string
+	if len(events) > p.Limit {
+		events = events[:p.Limit]
+		last := events[len(events)-1]
+		nextCursor = p.nextKey(last.Timestamp, last.UUID)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Events fetched successfully",
+		"data": fiber.Map{
+			"projectId":  ctx.ProjectID,
+			"filter":     tr.Filter,
+			"from":       tr.Start,
+			"to":         tr.End,
+			"events":     events,
+			"nextCursor": nextCursor,
+		},
+	})
+}
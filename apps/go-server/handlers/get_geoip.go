@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"supametrics/geo"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetGeoIPInfo reports the loaded GeoIP databases, their type and build date
+func GetGeoIPInfo(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "GeoIP info fetched successfully",
+		"data": fiber.Map{
+			"databases":      geo.Info(),
+			"remoteFallback": geo.RemoteEnabled(),
+		},
+	})
+}
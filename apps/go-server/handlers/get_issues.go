@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"supametrics/db"
+	"supametrics/middleware"
+	"supametrics/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+var issueSortColumns = map[string]string{
+	"last_seen":   "last_seen",
+	"first_seen":  "first_seen",
+	"occurrences": "occurrences",
+	"visitors":    "affected_visitors",
+}
+
+type IssueTrendData struct {
+	Time             time.Time `json:"time"`
+	Occurrences      int       `json:"occurrences"`
+	AffectedVisitors int       `json:"affectedVisitors"`
+}
+
+const issueColumns = `
+	uuid, project_id, fingerprint, message, stack, source_file, line_number,
+	column_number, release, first_seen, last_seen, occurrences, affected_visitors
+`
+
+func scanIssue(row interface{ Scan(...any) error }, issue *models.Issue) error {
+	return row.Scan(
+		&issue.UUID, &issue.ProjectID, &issue.Fingerprint, &issue.Message, &issue.Stack,
+		&issue.SourceFile, &issue.LineNumber, &issue.ColumnNumber, &issue.Release,
+		&issue.FirstSeen, &issue.LastSeen, &issue.Occurrences, &issue.AffectedVisitors,
+	)
+}
+
+// GetIssues lists the error issues of a project seen within the filter range
+func GetIssues(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	tr, msg := parseTimeRange(c, ctx.ProjectID, "thismonth")
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	sortColumn, ok := issueSortColumns[c.Query("sort", "last_seen")]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid sort provided",
+		})
+	}
+
+	p, msg := parsePage(c, ctx.ProjectID, 50, 200)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	startTime, endTime := tr.Start, tr.End
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM issues
+		WHERE project_id = $1 AND last_seen >= $2 AND first_seen <= $3
+		ORDER BY %s DESC, uuid
+		LIMIT %d OFFSET %d;
+	`, issueColumns, sortColumn, p.Limit+1, p.Cursor.Offset)
+
+	rows, err := db.DB.Query(query, ctx.ProjectID, startTime, endTime)
+	if err != nil {
+		log.Println("Issues query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error fetching issues"})
+	}
+	defer rows.Close()
+
+	issues := []models.Issue{}
+	for rows.Next() {
+		var issue models.Issue
+		if err := scanIssue(rows, &issue); err != nil {
+			log.Println("Error scanning issue row:", err)
+			continue
+		}
+		issues = append(issues, issue)
+	}
+
+	nextCursor := p.nextOffset(len(issues))
+	if nextCursor != nil {
+		issues = issues[:p.Limit]
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Issues fetched successfully",
+		"data": fiber.Map{
+			"projectId":  ctx.ProjectID,
+			"filter":     tr.Filter,
+			"from":       tr.Start,
+			"to":         tr.End,
+			"issues":     issues,
+			"nextCursor": nextCursor,
+		},
+	})
+}
+
+// GetIssueTrend returns an issue with its occurrences over time
+func GetIssueTrend(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	issueID, err := uuid.Parse(c.Params("issueId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid issue id"})
+	}
+
+	tr, msg := parseTimeRange(c, ctx.ProjectID, "thismonth")
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	eq, msg := parseEventQuery(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	var issue models.Issue
+	query := fmt.Sprintf(`SELECT %s FROM issues WHERE uuid = $1 AND project_id = $2;`, issueColumns)
+	err = scanIssue(db.DB.QueryRow(query, issueID, ctx.ProjectID), &issue)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Issue not found"})
+	}
+	if err != nil {
+		log.Println("Issue query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error fetching issue"})
+	}
+
+	where := eq.where(ctx.ProjectID, tr)
+	where.add("event_type = 'error'")
+	where.add("event_data->>'fingerprint' = %s", issue.Fingerprint)
+
+	trendQuery := fmt.Sprintf(`
+		SELECT
+			%s AS time_bucket,
+			COUNT(*) AS occurrences,
+			COUNT(DISTINCT visitor_id) AS affected_visitors
+		FROM analytics_events
+		WHERE %s
+		GROUP BY time_bucket
+		ORDER BY time_bucket;
+	`, tr.bucketSQL("timestamp"), where.String())
+
+	rows, err := db.DB.Query(trendQuery, where.Args()...)
+	if err != nil {
+		log.Println("Issue trend query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error fetching trend"})
+	}
+	defer rows.Close()
+
+	var trend []IssueTrendData
+	for rows.Next() {
+		var td IssueTrendData
+		if err := rows.Scan(&td.Time, &td.Occurrences, &td.AffectedVisitors); err != nil {
+			log.Println("Error scanning trend row:", err)
+			continue
+		}
+		td.Time = td.Time.In(tr.Location())
+		trend = append(trend, td)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Issue fetched successfully",
+		"data": fiber.Map{
+			"projectId": ctx.ProjectID,
+			"filter":    tr.Filter,
+			"from":      tr.Start,
+			"to":        tr.End,
+			"issue":     issue,
+			"trend":     trend,
+		},
+	})
+}
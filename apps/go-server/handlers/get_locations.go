@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"supametrics/db"
+	"supametrics/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// columns each location breakdown groups by. Regions and cities are
+// grouped with their country, names repeat across countries.
+var locationGroupings = map[string][]string{
+	"continent": {"continent"},
+	"country":   {"country"},
+	"region":    {"country", "region"},
+	"city":      {"country", "region", "city"},
+	"asn":       {"asn", "as_organization"},
+}
+
+type LocationBreakdown struct {
+	Continent      *string `json:"continent,omitempty"`
+	Country        *string `json:"country,omitempty"`
+	CountryName    *string `json:"countryName,omitempty"`
+	Region         *string `json:"region,omitempty"`
+	City           *string `json:"city,omitempty"`
+	ASN            *int    `json:"asn,omitempty"`
+	ASOrganization *string `json:"asOrganization,omitempty"`
+	TotalVisits    int     `json:"totalVisits"`
+	UniqueVisitors int     `json:"uniqueVisitors"`
+}
+
+// GetLocations breaks the visits of a project down by continent, country,
+// region, city or autonomous system
+func GetLocations(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	tr, msg := parseTimeRange(c, ctx.ProjectID, "today")
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	eq, msg := parseEventQuery(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	groupBy := c.Query("groupBy", "country")
+	grouping, ok := locationGroupings[groupBy]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid groupBy provided, use continent, country, region, city or asn",
+		})
+	}
+
+	p, msg := parsePage(c, ctx.ProjectID, 50, 200)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	grouped := func(column string) bool {
+		for _, g := range grouping {
+			if g == column {
+				return true
+			}
+		}
+		return false
+	}
+	selected := func(column, null string) string {
+		if grouped(column) {
+			return column
+		}
+		return null
+	}
+
+	countryName := "NULL::text"
+	if grouped("country") {
+		// stored names follow the locale at the time, pick one per country
+		countryName = "MAX(country_name)"
+	}
+
+	where := eq.where(ctx.ProjectID, tr)
+
+	query := fmt.Sprintf(`
+		SELECT
+			%s, %s, %s, %s, %s, %s, %s,
+			COUNT(*) AS total_visits,
+			COUNT(DISTINCT visitor_id) AS unique_visitors
+		FROM analytics_events
+		WHERE %s
+		GROUP BY %s
+		ORDER BY total_visits DESC, %s
+		LIMIT %d OFFSET %d;
+	`,
+		selected("continent", "NULL::text"), selected("country", "NULL::text"), countryName,
+		selected("region", "NULL::text"), selected("city", "NULL::text"),
+		selected("asn", "NULL::integer"), selected("as_organization", "NULL::text"),
+		where.String(), strings.Join(grouping, ", "), strings.Join(grouping, ", "), p.Limit+1, p.Cursor.Offset)
+
+	rows, err := db.DB.Query(query, where.Args()...)
+	if err != nil {
+		log.Println("Locations query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error fetching locations"})
+	}
+	defer rows.Close()
+
+	locations := []LocationBreakdown{}
+	for rows.Next() {
+		var l LocationBreakdown
+		if err := rows.Scan(
+			&l.Continent, &l.Country, &l.CountryName, &l.Region, &l.City,
+			&l.ASN, &l.ASOrganization, &l.TotalVisits, &l.UniqueVisitors,
+		); err != nil {
+			log.Println("Error scanning location row:", err)
+			continue
+		}
+		locations = append(locations, l)
+	}
+
+	nextCursor := p.nextOffset(len(locations))
+	if nextCursor != nil {
+		locations = locations[:p.Limit]
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Locations fetched successfully",
+		"data": fiber.Map{
+			"projectId":  ctx.ProjectID,
+			"filter":     tr.Filter,
+			"from":       tr.Start,
+			"to":         tr.End,
+			"groupBy":    groupBy,
+			"locations":  locations,
+			"nextCursor": nextCursor,
+		},
+	})
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"supametrics/db"
+	"supametrics/middleware"
+	"supametrics/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// expressions each screen breakdown groups by
+var screenGroupings = map[string]string{
+	"screen_size": "screen_size",
+	"viewport":    utils.ScreenSizeSQL("viewport_width"),
+	"resolution":  "screen_width || 'x' || screen_height",
+	"language":    "language",
+}
+
+type ScreenBreakdown struct {
+	Value          string `json:"value"`
+	TotalVisits    int    `json:"totalVisits"`
+	UniqueVisitors int    `json:"uniqueVisitors"`
+}
+
+// GetScreens breaks the visits of a project down by screen size breakpoint,
+// viewport breakpoint, screen resolution or language
+func GetScreens(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	tr, msg := parseTimeRange(c, ctx.ProjectID, "today")
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	eq, msg := parseEventQuery(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	groupBy := c.Query("groupBy", "screen_size")
+	expression, ok := screenGroupings[groupBy]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid groupBy provided, use screen_size, viewport, resolution or language",
+		})
+	}
+
+	p, msg := parsePage(c, ctx.ProjectID, 50, 200)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	where := eq.where(ctx.ProjectID, tr)
+	// events sent before these were captured have no value and are left out
+	where.add(expression + " IS NOT NULL")
+
+	query := fmt.Sprintf(`
+		SELECT
+			%s AS value,
+			COUNT(*) AS total_visits,
+			COUNT(DISTINCT visitor_id) AS unique_visitors
+		FROM analytics_events
+		WHERE %s
+		GROUP BY value
+		ORDER BY total_visits DESC, value
+		LIMIT %d OFFSET %d;
+	`, expression, where.String(), p.Limit+1, p.Cursor.Offset)
+
+	rows, err := db.DB.Query(query, where.Args()...)
+	if err != nil {
+		log.Println("Screens query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error fetching screens"})
+	}
+	defer rows.Close()
+
+	screens := []ScreenBreakdown{}
+	for rows.Next() {
+		var s ScreenBreakdown
+		if err := rows.Scan(&s.Value, &s.TotalVisits, &s.UniqueVisitors); err != nil {
+			log.Println("Error scanning screen row:", err)
+			continue
+		}
+		screens = append(screens, s)
+	}
+
+	nextCursor := p.nextOffset(len(screens))
+	if nextCursor != nil {
+		screens = screens[:p.Limit]
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Screens fetched successfully",
+		"data": fiber.Map{
+			"projectId":  ctx.ProjectID,
+			"filter":     tr.Filter,
+			"from":       tr.Start,
+			"to":         tr.End,
+			"groupBy":    groupBy,
+			"screens":    screens,
+			"nextCursor": nextCursor,
+		},
+	})
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"os"
+	"strings"
+	"supametrics/db"
+	"supametrics/tracker"
+	"supametrics/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const scriptCacheControl = "public, max-age=86400, stale-while-revalidate=604800"
+
+// trackerEndpoint is where the served tracker posts events.
+// TRACKER_ENDPOINT overrides it when the API sits behind a different host.
+func trackerEndpoint(c *fiber.Ctx) string {
+	if endpoint := os.Getenv("TRACKER_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	return c.BaseURL() + "/api/v1/analytics/log"
+}
+
+// ServeTrackerScript serves the generic tracker, configured through
+// data-* attributes on the script tag.
+func ServeTrackerScript(c *fiber.Ctx) error {
+	return sendScript(c, tracker.Config{Endpoint: trackerEndpoint(c)})
+}
+
+// ServeProjectTrackerScript serves the tracker with the project's
+// public key and settings baked in.
+func ServeProjectTrackerScript(c *fiber.Ctx) error {
+	publicKey := c.Params("publicKey")
+	if err := utils.ValidatePublicKeyFormat(publicKey); err != nil {
+		return c.Status(fiber.StatusNotFound).SendString("// unknown project")
+	}
+
+	query := `
+		SELECT pak.project_id
+		FROM project_api_keys pak
+		WHERE pak.public_key = $1
+		  AND pak.revoked = false
+		LIMIT 1;
+	`
+
+	var projectID string
+	err := db.DB.QueryRow(query, publicKey).Scan(&projectID)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).SendString("// unknown project")
+	}
+	if err != nil {
+		log.Println("db error:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString("// unavailable")
+	}
+
+	settings, err := utils.GetProjectSettings(projectID)
+	if err != nil {
+		log.Println("project settings error:", err)
+	}
+
+	return sendScript(c, tracker.Config{
+		Endpoint:      trackerEndpoint(c),
+		Key:           publicKey,
+		HashRouting:   settings.HashRouting,
+		TrackOutbound: settings.TrackOutbound,
+		ExcludedPaths: settings.ExcludedPaths,
+	})
+}
+
+func sendScript(c *fiber.Ctx, cfg tracker.Config) error {
+	script, err := tracker.Render(cfg)
+	if err != nil {
+		log.Println("tracker render error:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString("// unavailable")
+	}
+
+	hash := sha256.Sum256(script)
+	etag := `"` + hex.EncodeToString(hash[:8]) + `"`
+
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, scriptCacheControl)
+	c.Set(fiber.HeaderContentType, "application/javascript; charset=utf-8")
+
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" && strings.Contains(match, etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	return c.Send(script)
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"supametrics/db"
+	"supametrics/middleware"
+	"supametrics/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// dimensions a goal can be broken down by. A visitor is credited to the
+// values of their first event in the range, the one that brought them in.
+var goalBreakdownDimensions = map[string]string{
+	// utm_source when tagged, otherwise the referring host
+	"source":  `COALESCE(utm_source, NULLIF(substring(referrer from '^[A-Za-z][A-Za-z0-9+.-]*://([^/?#:]+)'), ''))`,
+	"country": "country",
+}
+
+type GoalConversion struct {
+	Goal              models.Goal `json:"goal"`
+	Conversions       int         `json:"conversions"`       // matching events
+	ConvertedVisitors int         `json:"convertedVisitors"` // visitors with at least one
+	ConversionRate    float64     `json:"conversionRate"`    // percentage of unique visitors
+	Revenue           *float64    `json:"revenue"`           // revenue goals only
+}
+
+type GoalTimelineData struct {
+	Time              time.Time `json:"time"`
+	Conversions       int       `json:"conversions"`
+	ConvertedVisitors int       `json:"convertedVisitors"`
+	Revenue           *float64  `json:"revenue"`
+}
+
+type GoalBreakdownRow struct {
+	// nil when visitors have no value, e.g. direct traffic for source
+	Value             *string  `json:"value"`
+	Visitors          int      `json:"visitors"`
+	ConvertedVisitors int      `json:"convertedVisitors"`
+	Conversions       int      `json:"conversions"`
+	ConversionRate    float64  `json:"conversionRate"` // percentage of the value's visitors
+	Revenue           *float64 `json:"revenue"`
+}
+
+// GetGoalConversions reports the conversions of every goal of the project
+// in the range, with the rate against its unique visitors
+func GetGoalConversions(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	tr, msg := parseTimeRange(c, ctx.ProjectID, "last7d")
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	eq, msg := parseEventQuery(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	goals, err := queryGoals(ctx.ProjectID)
+	if err != nil {
+		log.Println("Goals query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error fetching goals"})
+	}
+
+	conversions, uniqueVisitors, err := queryGoalConversions(ctx.ProjectID, tr, eq, goals)
+	if err != nil {
+		log.Println("Goal conversions query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error computing conversions"})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Goal conversions computed successfully",
+		"data": fiber.Map{
+			"projectId":      ctx.ProjectID,
+			"filter":         tr.Filter,
+			"from":           tr.Start,
+			"to":             tr.End,
+			"uniqueVisitors": uniqueVisitors,
+			"goals":          conversions,
+		},
+	})
+}
+
+// GetGoalReport reports the conversions of one goal over time and broken
+// down by source and country
+func GetGoalReport(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	goalID, err := uuid.Parse(c.Params("goalId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid goal id"})
+	}
+
+	tr, msg := parseTimeRange(c, ctx.ProjectID, "last7d")
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	eq, msg := parseEventQuery(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	limit := c.QueryInt("limit", 10)
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	var goal models.Goal
+	query := fmt.Sprintf(`SELECT %s FROM goals WHERE uuid = $1 AND project_id = $2;`, goalColumns)
+	err = scanGoal(db.DB.QueryRow(query, goalID, ctx.ProjectID), &goal)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Goal not found"})
+	}
+	if err != nil {
+		log.Println("Goal query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error fetching goal"})
+	}
+
+	conversions, uniqueVisitors, err := queryGoalConversions(ctx.ProjectID, tr, eq, []models.Goal{goal})
+	if err != nil {
+		log.Println("Goal conversions query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error computing conversions"})
+	}
+
+	timeline, err := queryGoalTimeline(ctx.ProjectID, tr, eq, goal)
+	if err != nil {
+		log.Println("Goal timeline query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error computing conversions"})
+	}
+
+	breakdowns := fiber.Map{}
+	for dimension := range goalBreakdownDimensions {
+		rows, err := queryGoalBreakdown(ctx.ProjectID, tr, eq, goal, dimension, limit)
+		if err != nil {
+			log.Println("Goal breakdown query error:", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error computing conversions"})
+		}
+		breakdowns[dimension] = rows
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Goal report computed successfully",
+		"data": fiber.Map{
+			"projectId":      ctx.ProjectID,
+			"filter":         tr.Filter,
+			"from":           tr.Start,
+			"to":             tr.End,
+			"timezone":       tr.Timezone,
+			"interval":       tr.Interval,
+			"uniqueVisitors": uniqueVisitors,
+			"conversion":     conversions[0],
+			"timeline":       timeline,
+			"breakdowns":     breakdowns,
+		},
+	})
+}
+
+// queryGoalConversions counts the unique visitors of the range and the
+// conversions of each goal in a single scan of its events
+func queryGoalConversions(projectID string, tr TimeRange, eq EventQuery, goals []models.Goal) ([]GoalConversion, int, error) {
+	where := eq.where(projectID, tr)
+
+	columns := []string{"COUNT(DISTINCT visitor_id)"}
+	for _, goal := range goals {
+		condition := goalCondition(goal, where)
+		columns = append(columns, fmt.Sprintf(
+			"COUNT(*) FILTER (WHERE %s), COUNT(DISTINCT visitor_id) FILTER (WHERE %s), SUM(%s) FILTER (WHERE %s)",
+			condition, condition, goalRevenue(goal, where), condition,
+		))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM analytics_events
+		WHERE %s;
+	`, strings.Join(columns, ",\n\t\t\t"), where.String())
+
+	var uniqueVisitors int
+	conversions := make([]GoalConversion, len(goals))
+	revenues := make([]sql.NullFloat64, len(goals))
+	dest := []any{&uniqueVisitors}
+	for i := range goals {
+		conversions[i].Goal = goals[i]
+		dest = append(dest, &conversions[i].Conversions, &conversions[i].ConvertedVisitors, &revenues[i])
+	}
+
+	if err := db.DB.QueryRow(query, where.Args()...).Scan(dest...); err != nil {
+		return nil, 0, err
+	}
+
+	for i := range conversions {
+		conversions[i].ConversionRate = percentage(conversions[i].ConvertedVisitors, uniqueVisitors)
+		conversions[i].Revenue = goalRevenueValue(goals[i], revenues[i])
+	}
+	return conversions, uniqueVisitors, nil
+}
+
+// queryGoalTimeline buckets the conversions of a goal like a time series,
+// buckets without any are filled with zeros
+func queryGoalTimeline(projectID string, tr TimeRange, eq EventQuery, goal models.Goal) ([]GoalTimelineData, error) {
+	where := eq.where(projectID, tr)
+	condition := goalCondition(goal, where)
+
+	query := fmt.Sprintf(`
+		SELECT
+			%s AS time_bucket,
+			COUNT(*),
+			COUNT(DISTINCT visitor_id),
+			SUM(%s)
+		FROM analytics_events
+		WHERE %s AND %s
+		GROUP BY time_bucket
+		ORDER BY time_bucket;
+	`, tr.bucketSQL("timestamp"), goalRevenue(goal, where), where.String(), condition)
+
+	rows, err := db.DB.Query(query, where.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byTime := map[int64]GoalTimelineData{}
+	for rows.Next() {
+		var td GoalTimelineData
+		var revenue sql.NullFloat64
+		if err := rows.Scan(&td.Time, &td.Conversions, &td.ConvertedVisitors, &revenue); err != nil {
+			log.Println("Error scanning goal timeline row:", err)
+			continue
+		}
+		td.Revenue = goalRevenueValue(goal, revenue)
+		byTime[td.Time.Unix()] = td
+	}
+
+	buckets := tr.buckets()
+	timeline := make([]GoalTimelineData, 0, len(buckets))
+	for _, t := range buckets {
+		td, ok := byTime[t.Unix()]
+		if !ok {
+			td = GoalTimelineData{Revenue: goalRevenueValue(goal, sql.NullFloat64{})}
+		}
+		td.Time = t
+		timeline = append(timeline, td)
+	}
+	return timeline, nil
+}
+
+// queryGoalBreakdown lists the values of a dimension that converted the
+// most visitors, with the rate against the visitors each value brought
+func queryGoalBreakdown(projectID string, tr TimeRange, eq EventQuery, goal models.Goal, dimension string, limit int) ([]GoalBreakdownRow, error) {
+	where := eq.where(projectID, tr)
+	where.add("visitor_id IS NOT NULL")
+	condition := goalCondition(goal, where)
+	revenue := goalRevenue(goal, where)
+	whereClause := where.String()
+
+	query := fmt.Sprintf(`
+		WITH visitors AS (
+			SELECT DISTINCT ON (visitor_id) visitor_id, %s AS value
+			FROM analytics_events
+			WHERE %s
+			ORDER BY visitor_id, timestamp, uuid
+		),
+		converted AS (
+			SELECT visitor_id, COUNT(*) AS conversions, SUM(%s) AS revenue
+			FROM analytics_events
+			WHERE %s AND %s
+			GROUP BY visitor_id
+		)
+		SELECT
+			v.value,
+			COUNT(*) AS visitors,
+			COUNT(c.visitor_id) AS converted,
+			COALESCE(SUM(c.conversions), 0),
+			SUM(c.revenue)
+		FROM visitors v
+		LEFT JOIN converted c ON c.visitor_id = v.visitor_id
+		GROUP BY v.value
+		HAVING COUNT(c.visitor_id) > 0
+		ORDER BY converted DESC, visitors DESC, v.value NULLS LAST
+		LIMIT %d;
+	`, goalBreakdownDimensions[dimension], whereClause, revenue, whereClause, condition, limit)
+
+	rows, err := db.DB.Query(query, where.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breakdown := []GoalBreakdownRow{}
+	for rows.Next() {
+		var row GoalBreakdownRow
+		var revenue sql.NullFloat64
+		if err := rows.Scan(&row.Value, &row.Visitors, &row.ConvertedVisitors, &row.Conversions, &revenue); err != nil {
+			log.Println("Error scanning goal breakdown row:", err)
+			continue
+		}
+		row.ConversionRate = percentage(row.ConvertedVisitors, row.Visitors)
+		row.Revenue = goalRevenueValue(goal, revenue)
+		breakdown = append(breakdown, row)
+	}
+	return breakdown, nil
+}
+
+// goalRevenueValue rounds a revenue sum to cents, 0 for revenue goals
+// without any and nil for other goals
+func goalRevenueValue(goal models.Goal, sum sql.NullFloat64) *float64 {
+	if goal.Type != "revenue" {
+		return nil
+	}
+	revenue := math.Round(sum.Float64*100) / 100
+	return &revenue
+}
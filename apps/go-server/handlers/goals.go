@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"supametrics/db"
+	"supametrics/middleware"
+	"supametrics/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	maxGoalsPerProject     = 50
+	maxGoalNameLength      = 100
+	defaultRevenueProperty = "revenue"
+)
+
+var goalTypes = map[string]bool{
+	"pageview": true,
+	"event":    true,
+	"revenue":  true,
+}
+
+const goalColumns = `
+	id, uuid, project_id, name, type, pathname, event_name, filters,
+	revenue_property, created_at, updated_at
+`
+
+func scanGoal(row interface{ Scan(...any) error }, goal *models.Goal) error {
+	return row.Scan(
+		&goal.ID, &goal.UUID, &goal.ProjectID, &goal.Name, &goal.Type, &goal.Pathname,
+		&goal.EventName, &goal.Filters, &goal.RevenueProperty, &goal.CreatedAt, &goal.UpdatedAt,
+	)
+}
+
+// validateGoalRequest trims req, drops the fields its type does not use and
+// fills in the defaults. The returned message is empty when it is valid.
+func validateGoalRequest(req *models.GoalRequest) string {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxGoalNameLength {
+		return fmt.Sprintf("Name must be 1-%d characters", maxGoalNameLength)
+	}
+	if !goalTypes[req.Type] {
+		return "Invalid type provided, use pageview, event or revenue"
+	}
+
+	if req.Type == "pageview" {
+		if req.Pathname == nil || *req.Pathname == "" {
+			return "Pageview goals need a pathname"
+		}
+		req.EventName, req.RevenueProperty = nil, nil
+	} else {
+		if req.EventName == nil || *req.EventName == "" {
+			return "Event and revenue goals need an event_name"
+		}
+		req.Pathname = nil
+	}
+
+	if req.Type == "revenue" {
+		if req.RevenueProperty == nil || *req.RevenueProperty == "" {
+			property := defaultRevenueProperty
+			req.RevenueProperty = &property
+		}
+		for _, segment := range strings.Split(*req.RevenueProperty, ".") {
+			if !filterKeyPattern.MatchString(segment) {
+				return "Invalid revenue_property, use an event_data key like revenue or order.total"
+			}
+		}
+	} else {
+		req.RevenueProperty = nil
+	}
+
+	if _, msg := parseFilters(req.Filters); msg != "" {
+		return msg
+	}
+	return ""
+}
+
+// goalCondition matches the events that complete the goal, its arguments
+// are bound to w
+func goalCondition(goal models.Goal, w *whereBuilder) string {
+	filters, msg := parseFilters(goal.Filters)
+	if msg != "" {
+		// filters are validated when saved, so this only guards old rows
+		log.Printf("goal %s has invalid filters: %s", goal.UUID, msg)
+		return "FALSE"
+	}
+
+	return w.group(func(sub *whereBuilder) {
+		switch goal.Type {
+		case "pageview":
+			sub.add("event_type = 'pageview'")
+			sub.add(`pathname LIKE %s ESCAPE '\'`, globToLike(deref(goal.Pathname)))
+		default:
+			sub.add("event_name = %s", deref(goal.EventName))
+		}
+		for _, f := range filters {
+			f.apply(sub)
+		}
+	})
+}
+
+// goalRevenue is the amount a revenue goal event carries, NULL when the
+// property is missing or not a number and for other goal types
+func goalRevenue(goal models.Goal, w *whereBuilder) string {
+	if goal.Type != "revenue" || goal.RevenueProperty == nil {
+		return "NULL::numeric"
+	}
+	path := pq.Array(strings.Split(*goal.RevenueProperty, "."))
+	return w.group(func(sub *whereBuilder) {
+		sub.add(`CASE WHEN event_data #>> %s ~ '^-?[0-9]+(\.[0-9]+)?$'
+			THEN (event_data #>> %s)::numeric END`, path, path)
+	})
+}
+
+// GetGoals lists the goals of a project
+func GetGoals(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	goals, err := queryGoals(ctx.ProjectID)
+	if err != nil {
+		log.Println("Goals query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error fetching goals"})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Goals fetched successfully",
+		"data":    goals,
+	})
+}
+
+func queryGoals(projectID string) ([]models.Goal, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM goals
+		WHERE project_id = $1
+		ORDER BY created_at, id;
+	`, goalColumns)
+
+	rows, err := db.DB.Query(query, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := []models.Goal{}
+	for rows.Next() {
+		var goal models.Goal
+		if err := scanGoal(rows, &goal); err != nil {
+			log.Println("Error scanning goal row:", err)
+			continue
+		}
+		goals = append(goals, goal)
+	}
+	return goals, rows.Err()
+}
+
+// CreateGoal defines a new goal, at most maxGoalsPerProject per project
+func CreateGoal(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	var req models.GoalRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid payload"})
+	}
+	if msg := validateGoalRequest(&req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	var count int
+	if err := db.DB.QueryRow(`SELECT COUNT(*) FROM goals WHERE project_id = $1;`, ctx.ProjectID).Scan(&count); err != nil {
+		log.Println("Goal count error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to create goal"})
+	}
+	if count >= maxGoalsPerProject {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": fmt.Sprintf("A project can have at most %d goals", maxGoalsPerProject),
+		})
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO goals (project_id, name, type, pathname, event_name, filters, revenue_property)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING %s;
+	`, goalColumns)
+
+	var goal models.Goal
+	err := scanGoal(db.DB.QueryRow(query,
+		ctx.ProjectID, req.Name, req.Type, req.Pathname, req.EventName, req.Filters, req.RevenueProperty,
+	), &goal)
+	if isUniqueViolation(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "A goal with this name already exists"})
+	}
+	if err != nil {
+		log.Println("Goal insert error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to create goal"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"message": "Goal created",
+		"data":    goal,
+	})
+}
+
+// UpdateGoal replaces the definition of a goal, its reports change with
+// it since conversions are computed from the events
+func UpdateGoal(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	goalID, err := uuid.Parse(c.Params("goalId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid goal id"})
+	}
+
+	var req models.GoalRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid payload"})
+	}
+	if msg := validateGoalRequest(&req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE goals
+		SET name = $3,
+			type = $4,
+			pathname = $5,
+			event_name = $6,
+			filters = $7,
+			revenue_property = $8,
+			updated_at = NOW()
+		WHERE uuid = $1 AND project_id = $2
+		RETURNING %s;
+	`, goalColumns)
+
+	var goal models.Goal
+	err = scanGoal(db.DB.QueryRow(query,
+		goalID, ctx.ProjectID, req.Name, req.Type, req.Pathname, req.EventName, req.Filters, req.RevenueProperty,
+	), &goal)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Goal not found"})
+	}
+	if isUniqueViolation(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "A goal with this name already exists"})
+	}
+	if err != nil {
+		log.Println("Goal update error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to update goal"})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Goal updated",
+		"data":    goal,
+	})
+}
+
+// DeleteGoal removes a goal, the events it counted are kept
+func DeleteGoal(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	goalID, err := uuid.Parse(c.Params("goalId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid goal id"})
+	}
+
+	query := fmt.Sprintf(`
+		DELETE FROM goals
+		WHERE uuid = $1 AND project_id = $2
+		RETURNING %s;
+	`, goalColumns)
+
+	var goal models.Goal
+	err = scanGoal(db.DB.QueryRow(query, goalID, ctx.ProjectID), &goal)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Goal not found"})
+	}
+	if err != nil {
+		log.Println("Goal delete error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to delete goal"})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Goal deleted",
+		"data":    goal,
+	})
+}
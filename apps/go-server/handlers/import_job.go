@@ -0,0 +1,550 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"supametrics/db"
+	"supametrics/geo"
+	"supametrics/models"
+	"supametrics/uaparser"
+	"supametrics/utils"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	importBatchSize    = 500
+	maxStoredRowErrors = 100
+
+	// running imports bump their updated_at this often, an unfinished one
+	// not updated for importStaleAfter lost the instance running it
+	importHeartbeatInterval = 30 * time.Second
+	importStaleAfter        = 3 * time.Minute
+)
+
+// running imports on this instance, keyed by import id, so they can be
+// cancelled on rollback
+var activeImports sync.Map
+
+// runningImport cancels an import, done is closed once it wrote its last
+// batch
+type runningImport struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+var importTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+type importRow struct {
+	number int
+	fields map[string]any
+}
+
+// importProgress is flushed to import_jobs after every batch
+type importProgress struct {
+	processed int
+	imported  int
+	failed    int
+	errors    []models.ImportRowError
+}
+
+func (p *importProgress) fail(row int, err error) {
+	p.failed++
+	if len(p.errors) < maxStoredRowErrors {
+		p.errors = append(p.errors, models.ImportRowError{Row: row, Error: err.Error()})
+	}
+}
+
+// runImport reads the uploaded file and inserts its rows in batches.
+// The file is removed once the job finishes.
+func runImport(job models.ImportJob, path string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	running := &runningImport{cancel: cancel, done: make(chan struct{})}
+	activeImports.Store(job.UUID.String(), running)
+	defer func() {
+		activeImports.Delete(job.UUID.String())
+		cancel()
+		os.Remove(path)
+		close(running.done)
+	}()
+
+	_, _ = db.DB.Exec(`UPDATE import_jobs SET status = $2, started_at = NOW(), updated_at = NOW() WHERE uuid = $1;`,
+		job.UUID, models.ImportStatusRunning)
+
+	file, err := os.Open(path)
+	if err != nil {
+		finishImport(job, &importProgress{}, models.ImportStatusFailed, err)
+		return
+	}
+	defer file.Close()
+
+	rows := make(chan importRow, importBatchSize)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(rows)
+		readErr <- readImportRows(ctx, job.Format, file, rows)
+	}()
+
+	// enrichment follows the project's geo settings
+	settings, err := utils.GetProjectSettings(job.ProjectID.String())
+	if err != nil {
+		log.Println("project settings error:", err)
+	}
+
+	progress := &importProgress{}
+	batch := make([]models.AnalyticsEvent, 0, importBatchSize)
+	batchRows := make([]int, 0, importBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := insertImportBatch(batch); err != nil {
+			for _, row := range batchRows {
+				progress.fail(row, err)
+			}
+		} else {
+			progress.imported += len(batch)
+		}
+		batch = batch[:0]
+		batchRows = batchRows[:0]
+		saveImportProgress(job, progress)
+		return ctx.Err()
+	}
+
+	for row := range rows {
+		progress.processed++
+
+		event, err := mapImportRow(row.fields, job, settings)
+		if err != nil {
+			progress.fail(row.number, err)
+			continue
+		}
+
+		batch = append(batch, event)
+		batchRows = append(batchRows, row.number)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				break
+			}
+		}
+	}
+
+	// drain the reader if we stopped early
+	for range rows {
+	}
+
+	if ctx.Err() != nil {
+		// cancelled by a rollback, which cleans up the rows itself
+		return
+	}
+
+	if err := flush(); err != nil {
+		return
+	}
+
+	if err := <-readErr; err != nil {
+		finishImport(job, progress, models.ImportStatusFailed, err)
+		return
+	}
+
+	finishImport(job, progress, models.ImportStatusCompleted, nil)
+}
+
+func readImportRows(ctx context.Context, format string, r io.Reader, rows chan<- importRow) error {
+	if format == "ndjson" {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+		number := 0
+		for scanner.Scan() {
+			number++
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+
+			// numbers keep their text, float64 would turn large ids into 1e+21
+			fields := map[string]any{}
+			decoder := json.NewDecoder(strings.NewReader(line))
+			decoder.UseNumber()
+			if err := decoder.Decode(&fields); err != nil {
+				fields = map[string]any{"__error": fmt.Sprintf("invalid json: %v", err)}
+			} else if decoder.More() {
+				fields = map[string]any{"__error": "invalid json: data after the object"}
+			}
+
+			select {
+			case rows <- importRow{number: number, fields: fields}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return scanner.Err()
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = false
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read csv header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	number := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		number++
+
+		fields := map[string]any{}
+		if err != nil {
+			fields["__error"] = err.Error()
+		} else {
+			for i, value := range record {
+				if i < len(header) && value != "" {
+					fields[header[i]] = value
+				}
+			}
+		}
+
+		select {
+		case rows <- importRow{number: number, fields: fields}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// mapImportRow maps a csv/ndjson row, keyed by analytics_events column
+// names, to an event. Original timestamps are kept as is.
+func mapImportRow(fields map[string]any, job models.ImportJob, settings models.ProjectSettings) (models.AnalyticsEvent, error) {
+	if msg, ok := fields["__error"]; ok {
+		return models.AnalyticsEvent{}, fmt.Errorf("%v", msg)
+	}
+
+	str := func(key string) *string {
+		value, ok := fields[key]
+		if !ok || value == nil {
+			return nil
+		}
+		s := strings.TrimSpace(fmt.Sprint(value))
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+
+	timestamp, err := parseImportTime(fields["timestamp"])
+	if err != nil {
+		return models.AnalyticsEvent{}, err
+	}
+
+	pathname := str("pathname")
+	if pathname == nil {
+		return models.AnalyticsEvent{}, fmt.Errorf("missing pathname")
+	}
+
+	eventType := "pageview"
+	if t := str("event_type"); t != nil {
+		eventType = *t
+	}
+
+	importID := job.UUID
+	event := models.AnalyticsEvent{
+		UUID:           uuid.New(),
+		ProjectID:      job.ProjectID,
+		Timestamp:      timestamp,
+		Pathname:       *pathname,
+		Referrer:       str("referrer"),
+		Hostname:       str("hostname"),
+		UTMSource:      str("utm_source"),
+		UTMMedium:      str("utm_medium"),
+		UTMCampaign:    str("utm_campaign"),
+		UTMTerm:        str("utm_term"),
+		UTMContent:     str("utm_content"),
+		EventType:      eventType,
+		EventName:      str("event_name"),
+		VisitorID:      str("visitor_id"),
+		UserID:         utils.NormalizeUserID(str("user_id")),
+		Country:        str("country"),
+		CountryName:    str("country_name"),
+		Continent:      str("continent"),
+		City:           str("city"),
+		Region:         str("region"),
+		PostalCode:     str("postal_code"),
+		Timezone:       str("timezone"),
+		ISP:            str("isp"),
+		ASOrganization: str("as_organization"),
+		BrowserName:    str("browser_name"),
+		BrowserVersion: str("browser_version"),
+		OSName:         str("os_name"),
+		OSVersion:      str("os_version"),
+		DeviceType:     str("device_type"),
+		DeviceVendor:   str("device_vendor"),
+		DeviceModel:    str("device_model"),
+		UserAgent:      str("user_agent"),
+		ImportID:       &importID,
+	}
+
+	if sessionID := str("session_id"); sessionID != nil {
+		event.SessionID = *sessionID
+	} else {
+		event.SessionID = uuid.New().String()
+	}
+
+	if d := str("duration"); d != nil {
+		duration, err := strconv.ParseFloat(*d, 64)
+		if err != nil {
+			return models.AnalyticsEvent{}, fmt.Errorf("invalid duration %q", *d)
+		}
+		seconds := int(duration)
+		event.Duration = &seconds
+	}
+
+	for key, target := range map[string]**int{
+		"screen_width":   &event.ScreenWidth,
+		"screen_height":  &event.ScreenHeight,
+		"viewport_width": &event.ViewportWidth,
+	} {
+		if value := str(key); value != nil {
+			pixels, err := strconv.Atoi(*value)
+			if err != nil {
+				return models.AnalyticsEvent{}, fmt.Errorf("invalid %s %q", key, *value)
+			}
+			*target = utils.ValidScreenDimension(&pixels)
+		}
+	}
+	event.ScreenSize = utils.ScreenSize(event.ScreenWidth)
+
+	if lang := str("language"); lang != nil {
+		event.Language = utils.NormalizeLanguage(*lang)
+	}
+
+	if a := str("asn"); a != nil {
+		asn, err := strconv.Atoi(strings.TrimPrefix(*a, "AS"))
+		if err != nil {
+			return models.AnalyticsEvent{}, fmt.Errorf("invalid asn %q", *a)
+		}
+		event.ASN = &asn
+	}
+
+	switch data := fields["event_data"].(type) {
+	case map[string]any:
+		event.EventData = data
+	case string:
+		if data != "" {
+			if err := json.Unmarshal([]byte(data), &event.EventData); err != nil {
+				return models.AnalyticsEvent{}, fmt.Errorf("invalid event_data: %v", err)
+			}
+		}
+	}
+
+	if job.Enrich {
+		enrichImportedEvent(&event, str("ip"), settings)
+	}
+
+	return event, nil
+}
+
+// enrichImportedEvent re-runs geo and user agent enrichment for the
+// fields the row did not provide.
+func enrichImportedEvent(event *models.AnalyticsEvent, ip *string, settings models.ProjectSettings) {
+	if ip != nil && event.Country == nil {
+		setLocation(event, geo.Lookup(*ip), settings)
+	}
+
+	if event.UserAgent != nil && event.BrowserName == nil {
+		setDevice(event, uaparser.Parse(*event.UserAgent, uaparser.ClientHints{}))
+	}
+
+	if event.VisitorID == nil && ip != nil {
+		userAgent := ""
+		if event.UserAgent != nil {
+			userAgent = *event.UserAgent
+		}
+		visitorID := utils.GenerateAnonVisitorID(*ip, userAgent, event.Timestamp, settings.VisitorStrategy)
+		event.VisitorID = &visitorID
+	}
+}
+
+func parseImportTime(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case nil:
+		return time.Time{}, fmt.Errorf("missing timestamp")
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			f, err := v.Float64()
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid timestamp %q", v)
+			}
+			n = int64(f)
+		}
+		return unixImportTime(n), nil
+	case string:
+		v = strings.TrimSpace(v)
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return unixImportTime(n), nil
+		}
+		for _, layout := range importTimeLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t.UTC(), nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", v)
+	default:
+		return time.Time{}, fmt.Errorf("invalid timestamp %v", v)
+	}
+}
+
+// unixImportTime accepts both seconds and milliseconds
+func unixImportTime(n int64) time.Time {
+	if n > 1e11 {
+		return time.UnixMilli(n).UTC()
+	}
+	return time.Unix(n, 0).UTC()
+}
+
+func insertImportBatch(events []models.AnalyticsEvent) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if err := insertAnalyticsEventWith(tx, event); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func saveImportProgress(job models.ImportJob, progress *importProgress) {
+	_, err := db.DB.Exec(`
+		UPDATE import_jobs
+		SET processed_rows = $2, imported_rows = $3, failed_rows = $4, errors = $5, updated_at = NOW()
+		WHERE uuid = $1;
+	`, job.UUID, progress.processed, progress.imported, progress.failed, utils.ToJSON(progress.errors))
+	if err != nil {
+		log.Println("import progress update error:", err)
+	}
+}
+
+func finishImport(job models.ImportJob, progress *importProgress, status string, jobErr error) {
+	if jobErr != nil {
+		log.Printf("import %s failed: %v", job.UUID, jobErr)
+		progress.errors = append(progress.errors, models.ImportRowError{Row: 0, Error: jobErr.Error()})
+	}
+
+	saveImportProgress(job, progress)
+
+	_, err := db.DB.Exec(`UPDATE import_jobs SET status = $2, finished_at = NOW() WHERE uuid = $1;`, job.UUID, status)
+	if err != nil {
+		log.Println("import status update error:", err)
+	}
+}
+
+// errImportRunning is returned when rolling back an import another
+// instance is still running
+var errImportRunning = errors.New("import is still running")
+
+// rollbackImport stops a running import and removes everything it inserted
+func rollbackImport(importID uuid.UUID, status string) error {
+	if running, ok := activeImports.Load(importID.String()); ok {
+		running.(*runningImport).cancel()
+		// the in-flight batch must land before its rows are deleted
+		<-running.(*runningImport).done
+	} else if status == models.ImportStatusPending || status == models.ImportStatusRunning {
+		return errImportRunning
+	}
+
+	if _, err := db.DB.Exec(`DELETE FROM analytics_events WHERE import_id = $1;`, importID); err != nil {
+		return err
+	}
+	if _, err := db.DB.Exec(`DELETE FROM imported_stats WHERE import_id = $1;`, importID); err != nil {
+		return err
+	}
+
+	_, err := db.DB.Exec(`
+		UPDATE import_jobs
+		SET status = $2, imported_rows = 0, finished_at = NOW()
+		WHERE uuid = $1;
+	`, importID, models.ImportStatusRolledBack)
+	return err
+}
+
+// StartImportHeartbeat keeps the imports of this instance marked as alive
+// and fails the unfinished ones whose instance stopped, e.g. on a restart.
+// Imports other live instances are running are left alone.
+func StartImportHeartbeat() {
+	failInterruptedImports()
+
+	go func() {
+		ticker := time.NewTicker(importHeartbeatInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			heartbeatImports()
+			failInterruptedImports()
+		}
+	}()
+}
+
+// heartbeatImports bumps updated_at of the imports running on this instance
+func heartbeatImports() {
+	var ids []string
+	activeImports.Range(func(key, _ any) bool {
+		ids = append(ids, key.(string))
+		return true
+	})
+	if len(ids) == 0 {
+		return
+	}
+
+	_, err := db.DB.Exec(`UPDATE import_jobs SET updated_at = NOW() WHERE uuid = ANY($1::uuid[]);`, pq.Array(ids))
+	if err != nil {
+		log.Println("import heartbeat error:", err)
+	}
+}
+
+// failInterruptedImports marks the unfinished imports without a recent
+// heartbeat as failed, the instance running them is gone
+func failInterruptedImports() {
+	_, err := db.DB.Exec(`
+		UPDATE import_jobs
+		SET status = $1, finished_at = NOW()
+		WHERE status IN ($2, $3)
+		  AND updated_at < NOW() - $4 * interval '1 second';
+	`, models.ImportStatusFailed, models.ImportStatusPending, models.ImportStatusRunning, int(importStaleAfter.Seconds()))
+	if err != nil {
+		log.Println("failed to clean up interrupted imports:", err)
+	}
+}
@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"supametrics/db"
+	"supametrics/models"
+	"supametrics/utils"
+)
+
+// Plausible and GA4 exports hold daily aggregates instead of raw events,
+// so they are stored in imported_stats and merged into GetAnalytics for
+// the dates before a project's first raw event.
+
+// importedStat is one row of imported_stats
+type importedStat struct {
+	Date          time.Time
+	Dimension     string // "total", "page", "source", "country" or "device"
+	Value         string // empty for totals
+	Visitors      int
+	Pageviews     int
+	Visits        int
+	Bounces       int
+	VisitDuration int // summed seconds
+}
+
+type importedStatKey struct {
+	date      string
+	dimension string
+	value     string
+}
+
+// importedStats aggregates rows by date, dimension and value, e.g. the
+// region/city rows of a locations export collapse into their country.
+type importedStats map[importedStatKey]*importedStat
+
+func (s importedStats) add(stat importedStat) {
+	key := importedStatKey{stat.Date.Format("2006-01-02"), stat.Dimension, stat.Value}
+	existing, ok := s[key]
+	if !ok {
+		s[key] = &stat
+		return
+	}
+	existing.Visitors += stat.Visitors
+	existing.Pageviews += stat.Pageviews
+	existing.Visits += stat.Visits
+	existing.Bounces += stat.Bounces
+	existing.VisitDuration += stat.VisitDuration
+}
+
+// plausible export files, by filename prefix, with their dimension and
+// the column holding the dimension value
+var plausibleFiles = []struct {
+	prefix      string
+	dimension   string
+	valueColumn string
+}{
+	{"imported_visitors", "total", ""},
+	{"imported_pages", "page", "page"},
+	{"imported_sources", "source", "source"},
+	{"imported_locations", "country", "country"},
+	{"imported_devices", "device", "device"},
+}
+
+// GA4 column names, lowercased, mapped to the stat they hold. They are
+// listed by priority, a report with several dimension columns is
+// classified by the first of them.
+var ga4DimensionColumns = []struct{ column, dimension string }{
+	{"page path and screen class", "page"},
+	{"page path", "page"},
+	{"landing page", "page"},
+	{"session source / medium", "source"},
+	{"session source", "source"},
+	{"first user source", "source"},
+	{"country", "country"},
+	{"device category", "device"},
+}
+
+var ga4MetricColumns = []struct{ column, metric string }{
+	{"total users", "visitors"},
+	{"active users", "visitors"},
+	{"users", "visitors"},
+	{"views", "pageviews"},
+	{"sessions", "visits"},
+}
+
+// runSummaryImport reads a plausible zip or a GA4 csv into imported_stats
+func runSummaryImport(job models.ImportJob, filePath string) {
+	defer os.Remove(filePath)
+
+	_, _ = db.DB.Exec(`UPDATE import_jobs SET status = $2, started_at = NOW(), updated_at = NOW() WHERE uuid = $1;`,
+		job.UUID, models.ImportStatusRunning)
+
+	stats := importedStats{}
+	progress := &importProgress{}
+
+	var err error
+	if job.Format == "plausible" {
+		err = readPlausibleExport(filePath, stats, progress)
+	} else {
+		err = readGA4Export(filePath, stats, progress)
+	}
+	if err != nil {
+		finishImport(job, progress, models.ImportStatusFailed, err)
+		return
+	}
+
+	if err := insertImportedStats(job, stats); err != nil {
+		finishImport(job, progress, models.ImportStatusFailed, err)
+		return
+	}
+
+	progress.imported = len(stats)
+	finishImport(job, progress, models.ImportStatusCompleted, nil)
+}
+
+func readPlausibleExport(filePath string, stats importedStats, progress *importProgress) error {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open plausible export: %w", err)
+	}
+	defer archive.Close()
+
+	found := false
+	for _, file := range archive.File {
+		name := path.Base(file.Name)
+		for _, kind := range plausibleFiles {
+			if !strings.HasPrefix(name, kind.prefix) || !strings.HasSuffix(name, ".csv") {
+				continue
+			}
+			found = true
+
+			rc, err := file.Open()
+			if err != nil {
+				return err
+			}
+			err = readSummaryCSV(rc, name, stats, progress, func(columns map[string]string) (importedStat, error) {
+				return plausibleStat(columns, kind.dimension, kind.valueColumn)
+			})
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("no plausible export files found in archive")
+	}
+	return nil
+}
+
+func plausibleStat(columns map[string]string, dimension, valueColumn string) (importedStat, error) {
+	date, err := time.Parse("2006-01-02", columns["date"])
+	if err != nil {
+		return importedStat{}, fmt.Errorf("invalid date %q", columns["date"])
+	}
+
+	stat := importedStat{
+		Date:          date,
+		Dimension:     dimension,
+		Visitors:      parseStatNumber(columns["visitors"]),
+		Pageviews:     parseStatNumber(columns["pageviews"]),
+		Visits:        parseStatNumber(columns["visits"]),
+		Bounces:       parseStatNumber(columns["bounces"]),
+		VisitDuration: parseStatNumber(columns["visit_duration"]),
+	}
+	if valueColumn != "" {
+		stat.Value = columns[valueColumn]
+		if stat.Value == "" {
+			stat.Value = "(none)"
+		}
+	}
+	return stat, nil
+}
+
+// readGA4Export reads every table of a GA4 csv export. Tables are
+// separated by blank or "#" comment lines and each has its own header.
+func readGA4Export(filePath string, stats importedStats, progress *importProgress) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var tables []string
+	var current strings.Builder
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			if current.Len() > 0 {
+				tables = append(tables, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		current.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if current.Len() > 0 {
+		tables = append(tables, current.String())
+	}
+
+	found := false
+	for i, table := range tables {
+		err := readSummaryCSV(strings.NewReader(table), fmt.Sprintf("table %d", i+1), stats, progress, func(columns map[string]string) (importedStat, error) {
+			return ga4Stat(columns)
+		})
+		if err == errNotDaily {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+	}
+
+	if !found {
+		return fmt.Errorf("no daily GA4 report found, export a report with a Date dimension")
+	}
+	return nil
+}
+
+var errNotDaily = errors.New("report has no date column")
+
+func ga4Stat(columns map[string]string) (importedStat, error) {
+	rawDate, ok := columns["date"]
+	if !ok {
+		return importedStat{}, errNotDaily
+	}
+	date, err := time.Parse("20060102", rawDate)
+	if err != nil {
+		return importedStat{}, fmt.Errorf("invalid date %q", rawDate)
+	}
+
+	stat := importedStat{Date: date, Dimension: "total"}
+	for _, d := range ga4DimensionColumns {
+		value, ok := columns[d.column]
+		if !ok {
+			continue
+		}
+		stat.Dimension = d.dimension
+		stat.Value = value
+		if d.dimension == "source" {
+			// "google / organic" -> "google"
+			stat.Value = strings.TrimSpace(strings.Split(value, "/")[0])
+		}
+		break
+	}
+
+	found := map[string]bool{}
+	for _, m := range ga4MetricColumns {
+		value, ok := columns[m.column]
+		if !ok || found[m.metric] {
+			continue
+		}
+		found[m.metric] = true
+		switch m.metric {
+		case "visitors":
+			stat.Visitors = parseStatNumber(value)
+		case "pageviews":
+			stat.Pageviews = parseStatNumber(value)
+		case "visits":
+			stat.Visits = parseStatNumber(value)
+		}
+	}
+	return stat, nil
+}
+
+// readSummaryCSV parses a csv with a header row, handing every row keyed by
+// lowercased column name to toStat.
+func readSummaryCSV(r io.Reader, source string, stats importedStats, progress *importProgress, toStat func(map[string]string) (importedStat, error)) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header of %s: %w", source, err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	number := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		number++
+		progress.processed++
+
+		if err != nil {
+			progress.fail(number, fmt.Errorf("%s: %v", source, err))
+			continue
+		}
+
+		columns := make(map[string]string, len(header))
+		for i, value := range record {
+			if i < len(header) {
+				columns[header[i]] = strings.TrimSpace(value)
+			}
+		}
+
+		stat, err := toStat(columns)
+		if err == errNotDaily {
+			return err
+		}
+		if err != nil {
+			progress.fail(number, fmt.Errorf("%s: %v", source, err))
+			continue
+		}
+		stats.add(stat)
+	}
+}
+
+// parseStatNumber reads counts like "1,234" or "12.5", invalid values count as 0
+func parseStatNumber(value string) int {
+	value = strings.ReplaceAll(value, ",", "")
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func insertImportedStats(job models.ImportJob, stats importedStats) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO imported_stats (
+			import_id, project_id, date, dimension, value,
+			visitors, pageviews, visits, bounces, visit_duration
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10);
+	`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, stat := range stats {
+		_, err := stmt.Exec(
+			job.UUID, job.ProjectID, stat.Date, stat.Dimension, stat.Value,
+			stat.Visitors, stat.Pageviews, stat.Visits, stat.Bounces, stat.VisitDuration,
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// firstRawEventDate returns the day of a project's first raw event, imported
+// stats are only used before it.
+func firstRawEventDate(projectID string) (time.Time, bool) {
+	var first time.Time
+	if err := utils.GetCache("first_event", projectID, &first); err == nil {
+		return first, !first.IsZero()
+	}
+
+	var firstEvent sql.NullTime
+	err := db.DB.QueryRow(`SELECT MIN(timestamp) FROM analytics_events WHERE project_id = $1;`, projectID).Scan(&firstEvent)
+	if err != nil {
+		log.Println("first event query error:", err)
+		return time.Time{}, false
+	}
+
+	if !firstEvent.Valid {
+		// not cached, so the first event counts as soon as it arrives
+		return time.Time{}, false
+	}
+
+	t := firstEvent.Time.UTC()
+	first = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	_ = utils.SetCache("first_event", projectID, first, time.Hour)
+	return first, true
+}
+
+// mergeImportedStats adds the imported daily totals between the range
+// start and the project's first raw event to a GetAnalytics summary and
+// frequency series. Imported dates are taken as days in the range's
+// timezone. Hourly and minutely series only get their totals merged.
+func mergeImportedStats(projectID string, tr TimeRange, summary *AnalyticsSummary, frequency []FrequencyData) []FrequencyData {
+	loc := tr.Location()
+	start := startOfDay(tr.Start.In(loc))
+	cutoff := startOfDay(tr.End.In(loc)).AddDate(0, 0, 1)
+	if first, ok := firstRawEventDate(projectID); ok {
+		// the first event's UTC day, as a calendar date
+		if firstDay := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc); firstDay.Before(cutoff) {
+			cutoff = firstDay
+		}
+	}
+	if !cutoff.After(start) {
+		return frequency
+	}
+
+	whereClause := "project_id = $1 AND dimension = 'total' AND date >= $2::date AND date < $3::date"
+	args := []interface{}{projectID, start.Format("2006-01-02"), cutoff.Format("2006-01-02")}
+
+	var pageviews, visitors int
+	err := db.DB.QueryRow(fmt.Sprintf(`
+		SELECT COALESCE(SUM(pageviews), 0), COALESCE(SUM(visitors), 0)
+		FROM imported_stats
+		WHERE %s;
+	`, whereClause), args...).Scan(&pageviews, &visitors)
+	if err != nil {
+		log.Println("Imported stats summary query error:", err)
+		return frequency
+	}
+	if pageviews == 0 && visitors == 0 {
+		return frequency
+	}
+
+	summary.TotalVisits += pageviews
+	summary.UniqueVisitors += visitors
+
+	if tr.Interval == "hour" || tr.Interval == "minute" {
+		return frequency
+	}
+
+	rows, err := db.DB.Query(fmt.Sprintf(`
+		SELECT
+			%s AS time_bucket,
+			SUM(pageviews),
+			SUM(visitors)
+		FROM imported_stats
+		WHERE %s
+		GROUP BY time_bucket;
+	`, tr.truncSQL("date::timestamp"), whereClause), args...)
+	if err != nil {
+		log.Println("Imported stats frequency query error:", err)
+		return frequency
+	}
+	defer rows.Close()
+
+	buckets := make(map[int64]int, len(frequency))
+	for i, fd := range frequency {
+		buckets[fd.Time.Unix()] = i
+	}
+
+	for rows.Next() {
+		var fd FrequencyData
+		if err := rows.Scan(&fd.Time, &fd.TotalVisits, &fd.UniqueVisitors); err != nil {
+			log.Println("Error scanning imported stats row:", err)
+			continue
+		}
+		fd.Time = fd.Time.In(loc)
+
+		if i, ok := buckets[fd.Time.Unix()]; ok {
+			frequency[i].TotalVisits += fd.TotalVisits
+			frequency[i].UniqueVisitors += fd.UniqueVisitors
+			continue
+		}
+		buckets[fd.Time.Unix()] = len(frequency)
+		frequency = append(frequency, fd)
+	}
+
+	sort.Slice(frequency, func(i, j int) bool {
+		return frequency[i].Time.Before(frequency[j].Time)
+	})
+	return frequency
+}
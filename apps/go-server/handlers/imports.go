@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"supametrics/db"
+	"supametrics/middleware"
+	"supametrics/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+var importFormats = map[string]string{
+	".csv":    "csv",
+	".ndjson": "ndjson",
+	".jsonl":  "ndjson",
+	".zip":    "plausible",
+}
+
+// formats holding aggregates rather than raw events
+var summaryImportFormats = map[string]bool{
+	"plausible": true,
+	"ga4":       true,
+}
+
+const importJobColumns = `
+	uuid, project_id, format, filename, status, enrich, processed_rows,
+	imported_rows, failed_rows, errors, created_at, finished_at
+`
+
+func scanImportJob(row interface{ Scan(...any) error }, job *models.ImportJob) error {
+	var rawErrors []byte
+	err := row.Scan(
+		&job.UUID, &job.ProjectID, &job.Format, &job.Filename, &job.Status, &job.Enrich,
+		&job.ProcessedRows, &job.ImportedRows, &job.FailedRows, &rawErrors,
+		&job.CreatedAt, &job.FinishedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	job.Errors = []models.ImportRowError{}
+	if len(rawErrors) > 0 {
+		_ = json.Unmarshal(rawErrors, &job.Errors)
+	}
+	return nil
+}
+
+// CreateImport accepts a csv or ndjson upload, or a plausible/GA4 export,
+// and imports it in the background
+func CreateImport(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Missing import file"})
+	}
+
+	format := c.FormValue("format")
+	if format == "" {
+		format = importFormats[strings.ToLower(filepath.Ext(file.Filename))]
+	}
+	if format != "csv" && format != "ndjson" && !summaryImportFormats[format] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Unsupported import format, use csv, ndjson, plausible or ga4"})
+	}
+
+	enrich := c.FormValue("enrich") == "true"
+
+	// keep the upload on disk, the request body is gone once we respond
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("supametrics-import-%s", uuid.New()))
+	if err := c.SaveFile(file, path); err != nil {
+		log.Println("import upload save error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to store import file"})
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO import_jobs (project_id, format, filename, status, enrich)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING %s;
+	`, importJobColumns)
+
+	var job models.ImportJob
+	err = scanImportJob(db.DB.QueryRow(query, ctx.ProjectID, format, file.Filename, models.ImportStatusPending, enrich), &job)
+	if err != nil {
+		os.Remove(path)
+		log.Println("import job insert error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to create import"})
+	}
+
+	if summaryImportFormats[format] {
+		go runSummaryImport(job, path)
+	} else {
+		go runImport(job, path)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"success": true,
+		"message": "Import started",
+		"data":    job,
+	})
+}
+
+// GetImport returns the progress and failed rows of an import
+func GetImport(c *fiber.Ctx) error {
+	job, err := findImportJob(c)
+	if job == nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Import fetched successfully",
+		"data":    job,
+	})
+}
+
+// RollbackImport removes every event an import inserted
+func RollbackImport(c *fiber.Ctx) error {
+	job, err := findImportJob(c)
+	if job == nil {
+		return err
+	}
+
+	if job.Status == models.ImportStatusRolledBack {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Import already rolled back"})
+	}
+
+	err = rollbackImport(job.UUID, job.Status)
+	if err == errImportRunning {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Import is still running, retry once it finishes"})
+	}
+	if err != nil {
+		log.Println("import rollback error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to roll back import"})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Import rolled back",
+	})
+}
+
+// findImportJob loads the import from the :importId param, scoped to the
+// current project. When no job is returned the error response was sent.
+func findImportJob(c *fiber.Ctx) (*models.ImportJob, error) {
+	var job models.ImportJob
+
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	importID, err := uuid.Parse(c.Params("importId"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid import id"})
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM import_jobs WHERE uuid = $1 AND project_id = $2;`, importJobColumns)
+	err = scanImportJob(db.DB.QueryRow(query, importID, ctx.ProjectID), &job)
+	if err == sql.ErrNoRows {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Import not found"})
+	}
+	if err != nil {
+		log.Println("import job query error:", err)
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error fetching import"})
+	}
+
+	return &job, nil
+}
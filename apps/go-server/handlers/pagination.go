@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"sort"
+	"strings"
+	"supametrics/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// pageCursor is the payload of a cursor token. Ranked lists resume at an
+// offset, event listings after the (timestamp, uuid) of the last row.
+type pageCursor struct {
+	Scope     string     `json:"s"`
+	Offset    int        `json:"o,omitempty"`
+	Timestamp *time.Time `json:"t,omitempty"`
+	UUID      *uuid.UUID `json:"u,omitempty"`
+}
+
+type page struct {
+	Limit  int
+	Cursor pageCursor
+}
+
+// parsePage reads the limit and cursor parameters. A cursor is only valid
+// for the project, endpoint and query parameters it was issued for.
+func parsePage(c *fiber.Ctx, projectID string, defaultLimit, maxLimit int) (page, string) {
+	p := page{
+		Limit:  c.QueryInt("limit", defaultLimit),
+		Cursor: pageCursor{Scope: cursorScope(c, projectID)},
+	}
+	if p.Limit < 1 || p.Limit > maxLimit {
+		p.Limit = defaultLimit
+	}
+
+	token := c.Query("cursor")
+	if token == "" {
+		return p, ""
+	}
+
+	var cursor pageCursor
+	if err := utils.VerifyCursor(token, &cursor); err != nil || cursor.Scope != p.Cursor.Scope {
+		return p, "Invalid cursor, it does not match this query"
+	}
+	if cursor.Offset < 0 || (cursor.Timestamp == nil) != (cursor.UUID == nil) {
+		return p, "Invalid cursor, it does not match this query"
+	}
+	p.Cursor = cursor
+	return p, ""
+}
+
+// cursorScope fingerprints everything that shapes the result set, the
+// cursor and limit excepted
+func cursorScope(c *fiber.Ctx, projectID string) string {
+	var params []string
+	c.Context().QueryArgs().VisitAll(func(key, value []byte) {
+		if k := string(key); k != "cursor" && k != "limit" {
+			params = append(params, k+"="+string(value))
+		}
+	})
+	sort.Strings(params)
+
+	sum := sha256.Sum256([]byte(projectID + "\n" + c.Path() + "\n" + strings.Join(params, "&")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// nextOffset returns the token for the page after a ranked list page that
+// fetched Limit+1 rows, nil on the last page
+func (p page) nextOffset(fetched int) *string {
+	if fetched <= p.Limit {
+		return nil
+	}
+	return p.sign(pageCursor{Scope: p.Cursor.Scope, Offset: p.Cursor.Offset + p.Limit})
+}
+
+// nextKey returns the token for the page after the row at (ts, id)
+func (p page) nextKey(ts time.Time, id uuid.UUID) *string {
+	return p.sign(pageCursor{Scope: p.Cursor.Scope, Timestamp: &ts, UUID: &id})
+}
+
+func (p page) sign(cursor pageCursor) *string {
+	token, err := utils.SignCursor(cursor)
+	if err != nil {
+		log.Println("Error signing cursor:", err)
+		return nil
+	}
+	return &token
+}
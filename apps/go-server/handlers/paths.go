@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"supametrics/db"
+	"supametrics/middleware"
+	"supametrics/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultPathDepth = 3
+	maxPathDepth     = 10
+	defaultPathNodes = 10
+	maxPathNodes     = 50
+)
+
+type PathNode struct {
+	ID    string `json:"id"`
+	Step  int    `json:"step"` // steps after the start, or before the end when negative
+	Type  string `json:"type"` // "page" or "event"
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+type PathEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Count  int    `json:"count"`
+}
+
+func pathNodeID(step int, kind, label string) string {
+	return fmt.Sprintf("%d:%s:%s", step, kind, label)
+}
+
+// GetPaths follows sessions from a start page or event forwards, or from
+// an end page or event backwards, and returns the most common steps as a
+// graph of nodes and weighted edges for a Sankey chart. Pathnames are
+// templated, so /orders/1 and /orders/2 are both /orders/:id.
+func GetPaths(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	tr, msg := parseTimeRange(c, ctx.ProjectID, "last7d")
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	eq, msg := parseEventQuery(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	anchors := map[string]string{
+		"startPath":  c.Query("startPath"),
+		"startEvent": c.Query("startEvent"),
+		"endPath":    c.Query("endPath"),
+		"endEvent":   c.Query("endEvent"),
+	}
+	var anchorParam, anchorValue string
+	for param, value := range anchors {
+		if value == "" {
+			continue
+		}
+		if anchorParam != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Provide only one of startPath, startEvent, endPath or endEvent",
+			})
+		}
+		anchorParam, anchorValue = param, value
+	}
+	if anchorParam == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Provide one of startPath, startEvent, endPath or endEvent",
+		})
+	}
+	backwards := anchorParam == "endPath" || anchorParam == "endEvent"
+
+	depth := c.QueryInt("depth", defaultPathDepth)
+	if depth < 1 || depth > maxPathDepth {
+		depth = defaultPathDepth
+	}
+	maxNodes := c.QueryInt("maxNodes", defaultPathNodes)
+	if maxNodes < 1 || maxNodes > maxPathNodes {
+		maxNodes = defaultPathNodes
+	}
+	minCount := c.QueryInt("minCount", 1)
+	if minCount < 1 {
+		minCount = 1
+	}
+
+	where := eq.where(ctx.ProjectID, tr)
+	// pageviews and named events make up a path, errors and the like don't
+	where.add("(event_type = 'pageview' OR event_name IS NOT NULL)")
+
+	var anchor string
+	if anchorParam == "startPath" || anchorParam == "endPath" {
+		anchor = where.group(func(sub *whereBuilder) {
+			sub.add("kind = 'page' AND label = %s", utils.TemplatePath(anchorValue))
+		})
+	} else {
+		anchor = where.group(func(sub *whereBuilder) {
+			sub.add("kind = 'event' AND label = %s", anchorValue)
+		})
+	}
+
+	// the anchor is the first match in a session, the path the steps after
+	// it, or before it when going backwards
+	window := fmt.Sprintf("n.rn BETWEEN a.rn AND a.rn + %d", depth)
+	distance := "n.rn - a.rn"
+	if backwards {
+		window = fmt.Sprintf("n.rn BETWEEN a.rn - %d AND a.rn", depth)
+		distance = "a.rn - n.rn"
+	}
+
+	query := fmt.Sprintf(`
+		WITH labelled AS (
+			SELECT
+				session_id, timestamp, uuid,
+				CASE WHEN event_type = 'pageview' THEN 'page' ELSE 'event' END AS kind,
+				CASE WHEN event_type = 'pageview' THEN %s ELSE event_name END AS label
+			FROM analytics_events
+			WHERE %s
+		),
+		deduped AS (
+			SELECT *, LAG(kind || ' ' || label) OVER (PARTITION BY session_id ORDER BY timestamp, uuid) AS previous
+			FROM labelled
+		),
+		numbered AS (
+			-- reloads and repeated events count as one step
+			SELECT session_id, kind, label,
+				ROW_NUMBER() OVER (PARTITION BY session_id ORDER BY timestamp, uuid) AS rn
+			FROM deduped
+			WHERE previous IS DISTINCT FROM kind || ' ' || label
+		),
+		anchors AS (
+			SELECT DISTINCT ON (session_id) session_id, rn
+			FROM numbered
+			WHERE %s
+			ORDER BY session_id, rn
+		),
+		path AS (
+			SELECT n.session_id, %s AS step, n.kind, n.label
+			FROM numbered n
+			JOIN anchors a ON a.session_id = n.session_id AND %s
+		)
+		SELECT step, kind, label, NULL, NULL, COUNT(*)
+		FROM path
+		GROUP BY step, kind, label
+		UNION ALL
+		SELECT p.step, p.kind, p.label, q.kind, q.label, COUNT(*)
+		FROM path p
+		JOIN path q ON q.session_id = p.session_id AND q.step = p.step + 1
+		GROUP BY p.step, p.kind, p.label, q.kind, q.label;
+	`, utils.PathTemplateSQL("pathname"), where.String(), anchor, distance, window)
+
+	rows, err := db.DB.Query(query, where.Args()...)
+	if err != nil {
+		log.Println("Paths query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error computing paths"})
+	}
+	defer rows.Close()
+
+	sign := 1
+	if backwards {
+		sign = -1
+	}
+
+	var nodes []PathNode
+	var edges []PathEdge
+	for rows.Next() {
+		var step, count int
+		var kind, label string
+		var nextKind, nextLabel *string
+		if err := rows.Scan(&step, &kind, &label, &nextKind, &nextLabel, &count); err != nil {
+			log.Println("Error scanning path row:", err)
+			continue
+		}
+
+		id := pathNodeID(sign*step, kind, label)
+		if nextKind == nil || nextLabel == nil {
+			nodes = append(nodes, PathNode{ID: id, Step: sign * step, Type: kind, Label: label, Count: count})
+			continue
+		}
+
+		// edges point forward in time
+		nextID := pathNodeID(sign*(step+1), *nextKind, *nextLabel)
+		if backwards {
+			edges = append(edges, PathEdge{Source: nextID, Target: id, Count: count})
+		} else {
+			edges = append(edges, PathEdge{Source: id, Target: nextID, Count: count})
+		}
+	}
+
+	nodes, edges = prunePaths(nodes, edges, maxNodes, minCount)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Paths computed successfully",
+		"data": fiber.Map{
+			"projectId": ctx.ProjectID,
+			"filter":    tr.Filter,
+			"from":      tr.Start,
+			"to":        tr.End,
+			anchorParam: anchorValue,
+			"depth":     depth,
+			"nodes":     nodes,
+			"edges":     edges,
+		},
+	})
+}
+
+// prunePaths keeps the maxNodes most common nodes of each step and the
+// edges between them seen at least minCount times, then drops what is no
+// longer connected to the anchor
+func prunePaths(nodes []PathNode, edges []PathEdge, maxNodes, minCount int) ([]PathNode, []PathEdge) {
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Step != nodes[j].Step {
+			return nodes[i].Step < nodes[j].Step
+		}
+		if nodes[i].Count != nodes[j].Count {
+			return nodes[i].Count > nodes[j].Count
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+
+	distance := map[string]int{}
+	perStep := map[int]int{}
+	reached := map[string]bool{}
+	for _, n := range nodes {
+		if perStep[n.Step] < maxNodes {
+			perStep[n.Step]++
+			distance[n.ID] = max(n.Step, -n.Step)
+			reached[n.ID] = n.Step == 0
+		}
+	}
+
+	// walking edges away from the anchor, a node is reached once the node
+	// before it is
+	far := func(e PathEdge) int { return max(distance[e.Source], distance[e.Target]) }
+	sort.Slice(edges, func(i, j int) bool {
+		if far(edges[i]) != far(edges[j]) {
+			return far(edges[i]) < far(edges[j])
+		}
+		if edges[i].Count != edges[j].Count {
+			return edges[i].Count > edges[j].Count
+		}
+		return edges[i].Source+edges[i].Target < edges[j].Source+edges[j].Target
+	})
+
+	prunedEdges := []PathEdge{}
+	for _, e := range edges {
+		_, keptSource := distance[e.Source]
+		_, keptTarget := distance[e.Target]
+		if e.Count < minCount || !keptSource || !keptTarget {
+			continue
+		}
+		near, farther := e.Source, e.Target
+		if distance[near] > distance[farther] {
+			near, farther = farther, near
+		}
+		if reached[near] {
+			reached[farther] = true
+			prunedEdges = append(prunedEdges, e)
+		}
+	}
+
+	prunedNodes := []PathNode{}
+	for _, n := range nodes {
+		if reached[n.ID] {
+			prunedNodes = append(prunedNodes, n)
+		}
+	}
+	return prunedNodes, prunedEdges
+}
@@ -1,262 +1,340 @@
 package handlers
 
 import (
-	"encoding/json"
+	"database/sql"
 	"fmt"
+	"log"
 	"net"
-	"net/http"
-	"os"
 	"time"
 
 	"supametrics/db"
+	"supametrics/geo"
 	"supametrics/middleware"
 	"supametrics/models"
+	"supametrics/uaparser"
 	"supametrics/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"github.com/mssola/user_agent"
-	"github.com/oschwald/geoip2-golang"
 )
 
-var GeoDB *geoip2.Reader
+func LogAnalyticsEvent(c *fiber.Ctx) error {
+	ctxVal := c.Locals("project_ctx")
+	if ctxVal == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Unauthorized"})
+	}
+	projectCtx := ctxVal.(middleware.ProjectContext)
 
-func InitGeoDB(dbPath string) error {
-	var err error
-	GeoDB, err = geoip2.Open(dbPath)
-	if err != nil {
-		return fmt.Errorf("failed to open MaxMind GeoLite2 DB: %w", err)
+	var req models.AnalyticsEventRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid payload"})
 	}
 
-	info, _ := os.Stat(dbPath)
-	if time.Since(info.ModTime()) > 30*24*time.Hour {
-		fmt.Println("GeoLite2 DB may be outdated. Update recommended.")
+	if req.Pathname == "" || req.EventType == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Missing required fields"})
 	}
 
-	fmt.Println("GeoLite2 database loaded:", dbPath)
-	return nil
-}
+	var fingerprint string
+	if req.EventType == "error" {
+		if req.Error == nil || req.Error.Message == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Missing error details"})
+		}
 
-type GeoIPData struct {
-	CountryName string
-	City        string
-}
+		fingerprint = utils.ErrorFingerprint(req.Error.Message, deref(req.Error.Stack), deref(req.Error.Source))
 
-func isPrivateIP(ipStr string) bool {
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
-		return false
+		// keep the raw error next to the event so trends can be drilled into
+		if req.EventData == nil {
+			req.EventData = map[string]any{}
+		}
+		req.EventData["error"] = req.Error
+		req.EventData["fingerprint"] = fingerprint
 	}
 
-	if ip.IsPrivate() || ip.IsLoopback() {
-		return true
-	}
-	return false
-}
+	event := newAnalyticsEvent(c, projectCtx.ProjectID, req)
 
-func getGeoIPLookup(ip string) (GeoIPData, error) {
-	if ip == "" {
-		return GeoIPData{CountryName: "Unknown", City: "Unknown"}, fmt.Errorf("IP address is empty")
+	queued, err := saveAnalyticsEvent(event)
+	if err != nil {
+		c.Set(fiber.HeaderRetryAfter, "30")
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"message": "Event could not be logged, retry later",
+		})
 	}
 
-	parsedIP := net.ParseIP(ip)
-	if parsedIP == nil {
-		return GeoIPData{CountryName: "Unknown", City: "Unknown"}, fmt.Errorf("failed to parse IP: %s", ip)
-	}
+	recordRealtime(event)
 
-	if isPrivateIP(ip) {
-		return GeoIPData{CountryName: "Private IP", City: "Private IP"}, nil
+	if queued {
+		// the issue is recorded once the dead letter is replayed
+		incrementProjectEvents(projectCtx.ProjectID)
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"status":  "accepted",
+			"message": "Event accepted",
+		})
 	}
 
-	if GeoDB == nil {
-		return GeoIPData{}, fmt.Errorf("GeoDB not initialized")
+	if fingerprint != "" {
+		if err := recordIssue(event, req.Error, fingerprint); err != nil {
+			log.Println("issue upsert error:", err)
+		}
 	}
 
-	record, err := GeoDB.City(parsedIP)
-	if err != nil {
-		return fallbackGeoLookup(ip)
-	}
+	incrementProjectEvents(projectCtx.ProjectID)
 
-	country := record.Country.IsoCode
-	city := record.City.Names["en"]
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Event logged",
+	})
+}
 
-	if country == "" {
-		country = "Unknown"
-	}
-	if city == "" {
-		city = "Unknown"
+// requestClientIP returns the client IP resolved by the IP middleware,
+// falling back to the remote address of the connection.
+func requestClientIP(c *fiber.Ctx) string {
+	clientIP, _ := c.Locals("clientIP").(string)
+
+	if clientIP == "" && c.Context().RemoteAddr() != nil {
+		ipPort := c.Context().RemoteAddr().String()
+		host, _, err := net.SplitHostPort(ipPort)
+		if err == nil {
+			clientIP = host
+		}
 	}
 
-	return GeoIPData{CountryName: country, City: city}, nil
+	if clientIP == "" {
+		clientIP = "Unknown"
+	}
+	return clientIP
 }
 
-func fallbackGeoLookup(ip string) (GeoIPData, error) {
-	url := fmt.Sprintf("http://ip-api.com/json/%s?fields=country,city,status,message", ip)
-	resp, err := http.Get(url)
+// newAnalyticsEvent builds an event from a request, enriched with the
+// visitor, geo and user agent data of the current client.
+func newAnalyticsEvent(c *fiber.Ctx, projectID string, req models.AnalyticsEventRequest) models.AnalyticsEvent {
+	clientIP := requestClientIP(c)
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	eventTime := time.Now().UTC()
+
+	settings, err := utils.GetProjectSettings(projectID)
 	if err != nil {
-		return GeoIPData{}, fmt.Errorf("fallback lookup failed: %w", err)
+		log.Println("project settings error:", err)
 	}
-	defer resp.Body.Close()
 
-	var data struct {
-		Status  string `json:"status"`
-		Country string `json:"country"`
-		City    string `json:"city"`
-		Message string `json:"message"`
-	}
+	anonVisitorID := utils.GenerateAnonVisitorID(clientIP, userAgent, eventTime, settings.VisitorStrategy)
+	sessionID := utils.AssignSession(projectID, anonVisitorID)
 
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return GeoIPData{}, err
+	event := models.AnalyticsEvent{
+		UUID:          uuid.New(),
+		ProjectID:     uuid.MustParse(projectID),
+		SessionID:     sessionID,
+		VisitorID:     &anonVisitorID,
+		UserID:        utils.NormalizeUserID(req.UserID),
+		Timestamp:     eventTime,
+		Pathname:      req.Pathname,
+		Referrer:      req.Referrer,
+		Hostname:      req.Hostname,
+		UTMSource:     req.UTMSource,
+		UTMMedium:     req.UTMMedium,
+		UTMCampaign:   req.UTMCampaign,
+		UTMTerm:       req.UTMTerm,
+		UTMContent:    req.UTMContent,
+		EventType:     req.EventType,
+		EventName:     req.EventName,
+		EventData:     req.EventData,
+		UserAgent:     &userAgent,
+		Duration:      req.Duration,
+		ScreenWidth:   utils.ValidScreenDimension(req.ScreenWidth),
+		ScreenHeight:  utils.ValidScreenDimension(req.ScreenHeight),
+		ViewportWidth: utils.ValidScreenDimension(req.ViewportWidth),
 	}
+	event.ScreenSize = utils.ScreenSize(event.ScreenWidth)
 
-	if data.Status != "success" {
-		return GeoIPData{}, fmt.Errorf("fallback lookup error: %s", data.Message)
+	if req.Language != nil {
+		event.Language = utils.NormalizeLanguage(*req.Language)
+	}
+	if event.Language == nil {
+		event.Language = utils.PreferredLanguage(c.Get(fiber.HeaderAcceptLanguage))
 	}
 
-	return GeoIPData{CountryName: data.Country, City: data.City}, nil
-}
+	setLocation(&event, geo.Lookup(clientIP), settings)
+	setDevice(&event, uaparser.Parse(userAgent, requestClientHints(c, req.ClientHints)))
 
-type UAParsedData struct {
-	BrowserName    string
-	BrowserVersion string
-	OSName         string
-	OSVersion      string
-	DeviceType     string
+	return event
 }
 
-func parseUserAgent(uaString string) UAParsedData {
-	if uaString == "" {
-		return UAParsedData{
-			BrowserName:    "Unknown",
-			BrowserVersion: "0.0",
-			OSName:         "Unknown",
-			OSVersion:      "0.0",
-			DeviceType:     "unknown",
-		}
+// requestClientHints combines the Client Hints headers with the ones the
+// tracker collected, headers win when both are present.
+func requestClientHints(c *fiber.Ctx, collected *models.ClientHints) uaparser.ClientHints {
+	hints := uaparser.HintsFromHeaders(func(key string) string { return c.Get(key) })
+	if collected == nil {
+		return hints
 	}
 
-	ua := user_agent.New(uaString)
-	name, version := ua.Browser()
-	os := ua.OS()
-
-	deviceType := "desktop"
-	if ua.Mobile() {
-		deviceType = "mobile"
+	if len(hints.FullVersionList) == 0 {
+		for i, b := range collected.FullVersionList {
+			if i == uaparser.MaxHintBrands {
+				break
+			}
+			hints.FullVersionList = append(hints.FullVersionList, uaparser.Brand{Brand: b.Brand, Version: b.Version})
+		}
 	}
-
-	return UAParsedData{
-		BrowserName:    name,
-		BrowserVersion: version,
-		OSName:         os,
-		OSVersion:      "Unknown",
-		DeviceType:     deviceType,
+	if hints.Platform == "" {
+		hints.Platform = collected.Platform
 	}
-}
-
-func LogAnalyticsEvent(c *fiber.Ctx) error {
-	ctxVal := c.Locals("project_ctx")
-	if ctxVal == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Unauthorized"})
+	if hints.PlatformVersion == "" {
+		hints.PlatformVersion = collected.PlatformVersion
 	}
-	projectCtx := ctxVal.(middleware.ProjectContext)
-
-	var req models.AnalyticsEventRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid payload"})
+	if hints.Model == "" {
+		hints.Model = collected.Model
 	}
-
-	if req.Pathname == "" || req.EventType == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Missing required fields"})
+	if hints.Mobile == nil {
+		hints.Mobile = collected.Mobile
 	}
+	return hints
+}
 
-	clientIP := c.Locals("clientIP").(string)
+// setDevice stores the parsed browser, OS and device on an event
+func setDevice(event *models.AnalyticsEvent, ua uaparser.Result) {
+	event.BrowserName = &ua.BrowserName
+	event.BrowserVersion = &ua.BrowserVersion
+	event.OSName = &ua.OSName
+	event.OSVersion = &ua.OSVersion
+	event.DeviceType = &ua.DeviceType
+	event.DeviceVendor = optionalString(ua.DeviceVendor)
+	event.DeviceModel = optionalString(ua.DeviceModel)
+}
 
-	if clientIP == "" && c.Context().RemoteAddr() != nil {
-		ipPort := c.Context().RemoteAddr().String()
-		host, _, err := net.SplitHostPort(ipPort)
-		if err == nil {
-			clientIP = host
-		}
-	}
+// setLocation stores a resolved location on an event, coarsened to the
+// project's geo precision and with the country named in its locale.
+func setLocation(event *models.AnalyticsEvent, loc geo.Location, settings models.ProjectSettings) {
+	loc = loc.WithPrecision(settings.GeoPrecision)
 
-	if clientIP == "" {
-		clientIP = "Unknown"
+	event.Country = &loc.Country
+	if name := geo.CountryName(loc.Country, settings.Locale); name != loc.Country {
+		event.CountryName = &name
 	}
-
-	userAgent := c.Get(fiber.HeaderUserAgent)
-	eventTime := time.Now().UTC()
-
-	sessionID := uuid.New().String()
-	anonVisitorID := utils.GenerateAnonVisitorID(clientIP, userAgent, eventTime)
-
-	geoData, err := getGeoIPLookup(clientIP)
-	if err != nil {
-		geoData = GeoIPData{CountryName: "Unknown", City: "Unknown"}
+	event.Continent = optionalString(loc.Continent)
+	event.Region = optionalString(loc.Region)
+	event.City = optionalString(loc.City)
+	event.PostalCode = optionalString(loc.PostalCode)
+	event.Latitude = loc.Latitude
+	event.Longitude = loc.Longitude
+	event.Timezone = optionalString(loc.Timezone)
+	event.ISP = optionalString(loc.ISP)
+	if loc.ASN != 0 {
+		asn := int(loc.ASN)
+		event.ASN = &asn
 	}
+	event.ASOrganization = optionalString(loc.ASOrganization)
+	event.Datacenter = loc.Datacenter
+}
 
-	uaData := parseUserAgent(userAgent)
-
-	event := models.AnalyticsEvent{
-		UUID:           uuid.New(),
-		ProjectID:      uuid.MustParse(projectCtx.ProjectID),
-		SessionID:      sessionID,
-		VisitorID:      &anonVisitorID,
-		Timestamp:      eventTime,
-		Pathname:       req.Pathname,
-		Referrer:       req.Referrer,
-		Hostname:       req.Hostname,
-		UTMSource:      req.UTMSource,
-		UTMMedium:      req.UTMMedium,
-		UTMCampaign:    req.UTMCampaign,
-		UTMTerm:        req.UTMTerm,
-		UTMContent:     req.UTMContent,
-		EventType:      req.EventType,
-		EventName:      req.EventName,
-		EventData:      req.EventData,
-		Country:        &geoData.CountryName,
-		City:           &geoData.City,
-		BrowserName:    &uaData.BrowserName,
-		BrowserVersion: &uaData.BrowserVersion,
-		OSName:         &uaData.OSName,
-		OSVersion:      &uaData.OSVersion,
-		DeviceType:     &uaData.DeviceType,
-		UserAgent:      &userAgent,
-		Duration:       req.Duration,
-	}
+func insertAnalyticsEvent(event models.AnalyticsEvent) error {
+	return insertAnalyticsEventWith(db.DB, event)
+}
 
+// insertAnalyticsEventWith inserts an event through a db or a transaction
+func insertAnalyticsEventWith(exec interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}, event models.AnalyticsEvent) error {
 	query := `
 		INSERT INTO analytics_events (
 			uuid, project_id, session_id, visitor_id, timestamp, pathname,
 			referrer, hostname, utm_source, utm_medium, utm_campaign,
 			utm_term, utm_content, event_type, event_name, event_data,
 			country, city, browser_name, browser_version, os_name, os_version,
-			device_type, user_agent, duration
+			device_type, user_agent, duration, import_id,
+			region, latitude, longitude, timezone, isp,
+			country_name, continent, postal_code, asn, as_organization, datacenter,
+			device_vendor, device_model,
+			screen_width, screen_height, screen_size, viewport_width, language,
+			user_id
 		) VALUES (
 			$1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,
-			$17,$18,$19,$20,$21,$22,$23,$24,$25
+			$17,$18,$19,$20,$21,$22,$23,$24,$25,$26,$27,$28,$29,$30,$31,
+			$32,$33,$34,$35,$36,$37,$38,$39,$40,$41,$42,$43,$44,$45
 		)
 	`
 
-	_, err = db.DB.Exec(query,
+	_, err := exec.Exec(query,
 		event.UUID, event.ProjectID, event.SessionID, event.VisitorID, event.Timestamp,
 		event.Pathname, event.Referrer, event.Hostname, event.UTMSource, event.UTMMedium,
 		event.UTMCampaign, event.UTMTerm, event.UTMContent, event.EventType, event.EventName,
 		utils.ToJSON(event.EventData), event.Country, event.City, event.BrowserName,
 		event.BrowserVersion, event.OSName, event.OSVersion, event.DeviceType,
-		event.UserAgent, event.Duration,
+		event.UserAgent, event.Duration, event.ImportID,
+		event.Region, event.Latitude, event.Longitude, event.Timezone, event.ISP,
+		event.CountryName, event.Continent, event.PostalCode, event.ASN, event.ASOrganization,
+		event.Datacenter, event.DeviceVendor, event.DeviceModel,
+		event.ScreenWidth, event.ScreenHeight, event.ScreenSize, event.ViewportWidth, event.Language,
+		event.UserID,
 	)
+	return err
+}
+
+// incrementProjectEvents keeps the cached monthly event count used by the
+// quota checks in sync.
+func incrementProjectEvents(projectID string) {
+	cacheKey := fmt.Sprintf("events:%s:%s", projectID, time.Now().Format("2006-01"))
+	_, _ = utils.IncrementCache("project_events", cacheKey, 30*24*time.Hour)
+}
+
+// recordIssue upserts the issue an error event belongs to and tracks
+// the affected visitors for it, in one transaction so the counters stay
+// in step with the stored visitors.
+func recordIssue(event models.AnalyticsEvent, details *models.ErrorDetails, fingerprint string) error {
+	tx, err := db.DB.Begin()
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to log event",
-			"error":   err.Error(),
-		})
+		return err
 	}
 
-	cacheKey := fmt.Sprintf("events:%s:%s", projectCtx.ProjectID, time.Now().Format("2006-01"))
-	_, _ = utils.IncrementCache("project_events", cacheKey, 30*24*time.Hour)
+	query := `
+		INSERT INTO issues (
+			project_id, fingerprint, message, stack, source_file, line_number,
+			column_number, release, first_seen, last_seen, occurrences, affected_visitors
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$9,1,0)
+		ON CONFLICT (project_id, fingerprint) DO UPDATE SET
+			last_seen = GREATEST(issues.last_seen, EXCLUDED.last_seen),
+			occurrences = issues.occurrences + 1,
+			stack = COALESCE(EXCLUDED.stack, issues.stack),
+			release = COALESCE(EXCLUDED.release, issues.release)
+		RETURNING uuid;
+	`
 
-	return c.JSON(fiber.Map{
-		"status":  "success",
-		"message": "Event logged",
-	})
+	var issueID uuid.UUID
+	err = tx.QueryRow(query,
+		event.ProjectID, fingerprint, details.Message, details.Stack, details.Source,
+		details.Line, details.Column, details.Release, event.Timestamp,
+	).Scan(&issueID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if event.VisitorID == nil {
+		return tx.Commit()
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO issue_visitors (issue_id, visitor_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING;
+	`, issueID, *event.VisitorID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// only count visitors we haven't seen for this issue yet
+	if n, _ := res.RowsAffected(); n > 0 {
+		_, err = tx.Exec(`UPDATE issues SET affected_visitors = affected_visitors + 1 WHERE uuid = $1;`, issueID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
 }
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"supametrics/middleware"
+	"supametrics/models"
+	"supametrics/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxRealtimeVisitors = 100
+
+	// comments sent on an idle stream so proxies keep it open
+	liveHeartbeatInterval = 15 * time.Second
+)
+
+type RealtimeCount struct {
+	Value    *string `json:"value"`
+	Visitors int     `json:"visitors"`
+}
+
+// recordRealtime marks the visitor of an accepted event as active and
+// streams the event to live dashboards. Redis errors are only logged, the
+// event itself is already saved.
+func recordRealtime(event models.AnalyticsEvent) {
+	if event.VisitorID != nil {
+		err := utils.TrackActiveVisitor(event.ProjectID.String(), utils.ActiveVisitor{
+			VisitorID: *event.VisitorID,
+			Pathname:  event.Pathname,
+			Country:   event.Country,
+			LastSeen:  event.Timestamp,
+		})
+		if err != nil {
+			log.Println("realtime tracking error:", err)
+		}
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Println("live event encoding error:", err)
+		return
+	}
+	if err := utils.PublishLiveEvent(event.ProjectID.String(), payload); err != nil {
+		log.Println("live event publish error:", err)
+	}
+}
+
+// GetRealtime returns the visitors active in the last five minutes with
+// the page they are on and where they are from
+func GetRealtime(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	now := time.Now()
+	visitors, err := utils.ActiveVisitors(ctx.ProjectID, now)
+	if err != nil {
+		log.Println("Realtime visitors error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error fetching realtime visitors"})
+	}
+
+	pages := map[string]int{}
+	countries := map[string]int{}
+	unknownCountry := 0
+	for _, v := range visitors {
+		pages[v.Pathname]++
+		if v.Country == nil {
+			unknownCountry++
+		} else {
+			countries[*v.Country]++
+		}
+	}
+
+	pageCounts := make([]RealtimeCount, 0, len(pages))
+	for pathname, n := range pages {
+		pageCounts = append(pageCounts, RealtimeCount{Value: &pathname, Visitors: n})
+	}
+	countryCounts := make([]RealtimeCount, 0, len(countries)+1)
+	for country, n := range countries {
+		countryCounts = append(countryCounts, RealtimeCount{Value: &country, Visitors: n})
+	}
+	if unknownCountry > 0 {
+		countryCounts = append(countryCounts, RealtimeCount{Visitors: unknownCountry})
+	}
+	sortRealtimeCounts(pageCounts)
+	sortRealtimeCounts(countryCounts)
+
+	active := len(visitors)
+	if len(visitors) > maxRealtimeVisitors {
+		visitors = visitors[:maxRealtimeVisitors]
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Realtime visitors fetched successfully",
+		"data": fiber.Map{
+			"projectId":      ctx.ProjectID,
+			"window":         int(utils.RealtimeWindow.Seconds()),
+			"at":             now.UTC(),
+			"activeVisitors": active,
+			"pages":          pageCounts,
+			"countries":      countryCounts,
+			"visitors":       visitors, // most recent first
+		},
+	})
+}
+
+// sortRealtimeCounts orders counts by visitors, then value with unknown
+// values last
+func sortRealtimeCounts(counts []RealtimeCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Visitors != counts[j].Visitors {
+			return counts[i].Visitors > counts[j].Visitors
+		}
+		if counts[i].Value == nil || counts[j].Value == nil {
+			return counts[j].Value == nil && counts[i].Value != nil
+		}
+		return *counts[i].Value < *counts[j].Value
+	})
+}
+
+// StreamLiveEvents streams the events of the project as server-sent
+// events while they are ingested. The stream ends when the client
+// disconnects.
+func StreamLiveEvents(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	projectID := ctx.ProjectID
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		subCtx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		sub := utils.SubscribeLiveEvents(subCtx, projectID)
+		defer sub.Close()
+
+		if _, err := sub.Receive(subCtx); err != nil {
+			log.Println("live events subscribe error:", err)
+			fmt.Fprint(w, "event: error\ndata: {\"message\":\"Live events unavailable\"}\n\n")
+			_ = w.Flush()
+			return
+		}
+
+		fmt.Fprint(w, "retry: 3000\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(liveHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		events := sub.Channel()
+		for {
+			select {
+			case msg, ok := <-events:
+				if !ok {
+					return
+				}
+				fmt.Fprintf(w, "event: event\ndata: %s\n\n", msg.Payload)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			// a failed flush means the client went away
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"supametrics/db"
+	"supametrics/middleware"
+	"supametrics/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultRetentionPeriods = 8
+	maxRetentionPeriods     = 52
+	maxCohorts              = 366
+)
+
+// identified users keep their id across devices, everyone else is
+// followed by their visitor hash
+const retentionIdentity = "COALESCE(user_id, visitor_id)"
+
+type RetentionPeriod struct {
+	Period   int     `json:"period"` // periods since the cohort's own
+	Visitors int     `json:"visitors"`
+	Rate     float64 `json:"rate"` // percentage of the cohort
+}
+
+type Cohort struct {
+	Cohort    time.Time         `json:"cohort"`
+	Size      int               `json:"size"`
+	Retention []RetentionPeriod `json:"retention"`
+}
+
+// GetRetention groups visitors into cohorts by the period of their first
+// event, or first startEvent, and reports the share of each cohort that
+// came back, or fired returnEvent, in each later period
+func GetRetention(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	tr, msg := parseTimeRange(c, ctx.ProjectID, "last30d")
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	period := c.Query("period", "week")
+	if period != "day" && period != "week" && period != "month" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid period provided, use day, week or month"})
+	}
+	// cohorts are bucketed like a time series with the period as interval
+	tr.Interval = period
+	if len(tr.buckets()) > maxCohorts {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": fmt.Sprintf("Range too long for %s cohorts, at most %d are allowed", period, maxCohorts),
+		})
+	}
+
+	periods := c.QueryInt("periods", defaultRetentionPeriods)
+	if periods < 1 || periods > maxRetentionPeriods {
+		periods = defaultRetentionPeriods
+	}
+
+	eq, msg := parseEventQuery(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+	// one event name can't define both the cohort and the return
+	if eq.EventName != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "eventName is not supported for retention, use startEvent and returnEvent",
+		})
+	}
+
+	settings, err := utils.GetProjectSettings(ctx.ProjectID)
+	if err != nil {
+		log.Println("project settings error:", err)
+	}
+
+	startEvent, returnEvent := c.Query("startEvent"), c.Query("returnEvent")
+
+	// activity is followed until the last period of the newest cohort
+	activityEnd := tr.truncate(tr.End.In(tr.Location()))
+	for i := 0; i <= periods; i++ {
+		activityEnd = tr.next(activityEnd)
+	}
+
+	w := &whereBuilder{}
+	filters := w.group(func(sub *whereBuilder) {
+		sub.add("project_id = %s", ctx.ProjectID)
+		sub.add(retentionIdentity + " IS NOT NULL")
+		if eq.ExcludeDatacenter {
+			sub.add("NOT datacenter")
+		}
+		for _, f := range eq.Filters {
+			f.apply(sub)
+		}
+	})
+	firstWhere := w.group(func(sub *whereBuilder) {
+		sub.add("timestamp <= %s", tr.End)
+		if startEvent != "" {
+			sub.add("event_name = %s", startEvent)
+		}
+	})
+	firstInRange := w.group(func(sub *whereBuilder) {
+		sub.add("MIN(timestamp) >= %s", tr.Start)
+	})
+	activityWhere := w.group(func(sub *whereBuilder) {
+		sub.add("timestamp >= %s AND timestamp < %s", tr.Start, activityEnd.UTC())
+		if returnEvent != "" {
+			sub.add("event_name = %s", returnEvent)
+		}
+	})
+
+	// the first event is looked up over all history, visitors seen before
+	// the range belong to no cohort in it
+	query := fmt.Sprintf(`
+		WITH firsts AS (
+			SELECT %s AS actor, MIN(timestamp) AS first_seen
+			FROM analytics_events
+			WHERE %s AND %s
+			GROUP BY actor
+			HAVING %s
+		),
+		cohorts AS (
+			SELECT actor, %s AS cohort FROM firsts
+		),
+		activity AS (
+			SELECT DISTINCT %s AS actor, %s AS active
+			FROM analytics_events
+			WHERE %s AND %s
+		)
+		SELECT c.cohort, NULL::timestamptz, COUNT(*) FROM cohorts c GROUP BY c.cohort
+		UNION ALL
+		SELECT c.cohort, a.active, COUNT(*)
+		FROM cohorts c
+		JOIN activity a ON a.actor = c.actor AND a.active >= c.cohort
+		GROUP BY c.cohort, a.active
+		ORDER BY 1, 2 NULLS FIRST;
+	`,
+		retentionIdentity, filters, firstWhere, firstInRange,
+		tr.bucketSQL("first_seen"),
+		retentionIdentity, tr.bucketSQL("timestamp"), filters, activityWhere,
+	)
+
+	rows, err := db.DB.Query(query, w.Args()...)
+	if err != nil {
+		log.Println("Retention query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error computing retention"})
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	cohorts := []Cohort{}
+	index := map[int64]int{}
+	for rows.Next() {
+		var cohortTime time.Time
+		var active *time.Time
+		var count int
+		if err := rows.Scan(&cohortTime, &active, &count); err != nil {
+			log.Println("Error scanning retention row:", err)
+			continue
+		}
+		cohortTime = cohortTime.In(tr.Location())
+
+		if active == nil {
+			cohort := Cohort{Cohort: cohortTime, Size: count}
+			// periods that have not started yet are left out
+			for t, k := cohortTime, 0; k <= periods && !t.After(now); t, k = tr.next(t), k+1 {
+				cohort.Retention = append(cohort.Retention, RetentionPeriod{Period: k})
+			}
+			index[cohortTime.Unix()] = len(cohorts)
+			cohorts = append(cohorts, cohort)
+			continue
+		}
+
+		i, ok := index[cohortTime.Unix()]
+		if !ok {
+			continue
+		}
+		cohort := &cohorts[i]
+		k := periodsBetween(tr, cohortTime, active.In(tr.Location()))
+		if k >= 0 && k < len(cohort.Retention) {
+			cohort.Retention[k].Visitors = count
+			cohort.Retention[k].Rate = percentage(count, cohort.Size)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Retention computed successfully",
+		"data": fiber.Map{
+			"projectId":       ctx.ProjectID,
+			"filter":          tr.Filter,
+			"from":            tr.Start,
+			"to":              tr.End,
+			"timezone":        tr.Timezone,
+			"period":          period,
+			"visitorStrategy": settings.VisitorStrategy,
+			"startEvent":      startEvent,
+			"returnEvent":     returnEvent,
+			"cohorts":         cohorts,
+		},
+	})
+}
+
+// periodsBetween counts the periods of tr from the cohort to t, -1 when t
+// is not the start of one
+func periodsBetween(tr TimeRange, cohort, t time.Time) int {
+	for k, p := 0, cohort; !p.After(t); k, p = k+1, tr.next(p) {
+		if p.Equal(t) {
+			return k
+		}
+	}
+	return -1
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"supametrics/db"
+)
+
+const topSessionPages = 10
+
+type SessionSummary struct {
+	TotalSessions         int     `json:"totalSessions"`
+	BounceRate            float64 `json:"bounceRate"` // percentage of sessions with a single pageview and nothing else
+	AvgSessionDuration    float64 `json:"avgSessionDuration"`
+	MedianSessionDuration float64 `json:"medianSessionDuration"`
+	PageviewsPerSession   float64 `json:"pageviewsPerSession"`
+	// from the duration the tracker reports for pageviews, nil without any
+	AvgTimeOnPage *float64 `json:"avgTimeOnPage"`
+
+	EntryPages []SessionPage `json:"entryPages,omitempty"`
+	ExitPages  []SessionPage `json:"exitPages,omitempty"`
+}
+
+type SessionPage struct {
+	Pathname string `json:"pathname"`
+	Sessions int    `json:"sessions"`
+}
+
+// sessionWhere selects the events of a range that belong to a session with
+// at least one event matching eq. Sessions are then built from all their
+// events, not only the matching ones.
+func sessionWhere(projectID string, tr TimeRange, eq EventQuery) *whereBuilder {
+	where := EventQuery{}.where(projectID, tr)
+	if eq.isEmpty() {
+		return where
+	}
+
+	matched := where.group(func(sub *whereBuilder) {
+		sub.add("project_id = %s", projectID)
+		sub.add("timestamp >= %s AND timestamp <= %s", tr.Start, tr.End)
+		eq.apply(sub)
+	})
+	// added as is, the placeholders of the group are already numbered
+	where.conditions = append(where.conditions,
+		"session_id IN (SELECT session_id FROM analytics_events WHERE "+matched+")")
+	return where
+}
+
+// querySessions aggregates the sessions of a range that have an event
+// matching eq. A session lasts from its first to its last event, plus the
+// reported time on its last page. Durations are in seconds. Errors are
+// logged, the returned message is meant for the client.
+func querySessions(projectID string, tr TimeRange, eq EventQuery, withPages bool) (SessionSummary, string) {
+	where := sessionWhere(projectID, tr, eq)
+	whereClause := where.String()
+
+	summaryQuery := fmt.Sprintf(`
+		WITH sessions AS (
+			SELECT
+				COUNT(*) AS events,
+				COUNT(*) FILTER (WHERE event_type = 'pageview') AS pageviews,
+				(EXTRACT(EPOCH FROM MAX(timestamp) - MIN(timestamp))
+					+ COALESCE((ARRAY_AGG(duration ORDER BY timestamp DESC, uuid DESC))[1], 0))::double precision AS duration
+			FROM analytics_events
+			WHERE %s
+			GROUP BY session_id
+		)
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE events = 1 AND pageviews = 1),
+			COALESCE(AVG(duration), 0),
+			COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY duration), 0),
+			COALESCE(AVG(pageviews), 0),
+			(
+				SELECT AVG(duration)
+				FROM analytics_events
+				WHERE %s AND event_type = 'pageview' AND duration IS NOT NULL
+			)
+		FROM sessions;
+	`, whereClause, whereClause)
+
+	var summary SessionSummary
+	var bounces int
+	var avgTimeOnPage sql.NullFloat64
+	err := db.DB.QueryRow(summaryQuery, where.Args()...).Scan(
+		&summary.TotalSessions, &bounces, &summary.AvgSessionDuration,
+		&summary.MedianSessionDuration, &summary.PageviewsPerSession, &avgTimeOnPage,
+	)
+	if err != nil {
+		log.Println("Session summary query error:", err)
+		return summary, "Database error fetching sessions"
+	}
+
+	summary.BounceRate = percentage(bounces, summary.TotalSessions)
+	summary.AvgSessionDuration = math.Round(summary.AvgSessionDuration*10) / 10
+	summary.MedianSessionDuration = math.Round(summary.MedianSessionDuration*10) / 10
+	summary.PageviewsPerSession = math.Round(summary.PageviewsPerSession*100) / 100
+	if avgTimeOnPage.Valid {
+		rounded := math.Round(avgTimeOnPage.Float64*10) / 10
+		summary.AvgTimeOnPage = &rounded
+	}
+
+	if !withPages {
+		return summary, ""
+	}
+
+	var msg string
+	if summary.EntryPages, msg = querySessionPages(whereClause, where.Args(), "ASC"); msg != "" {
+		return summary, msg
+	}
+	if summary.ExitPages, msg = querySessionPages(whereClause, where.Args(), "DESC"); msg != "" {
+		return summary, msg
+	}
+	return summary, ""
+}
+
+// querySessionPages counts the first pageview of each session with order
+// ASC, the entry pages, or the last with DESC, the exit pages
+func querySessionPages(whereClause string, args []interface{}, order string) ([]SessionPage, string) {
+	query := fmt.Sprintf(`
+		SELECT pathname, COUNT(*) AS sessions
+		FROM (
+			SELECT DISTINCT ON (session_id) session_id, pathname
+			FROM analytics_events
+			WHERE %s AND event_type = 'pageview'
+			ORDER BY session_id, timestamp %s, uuid %s
+		) pages
+		GROUP BY pathname
+		ORDER BY sessions DESC, pathname
+		LIMIT %d;
+	`, whereClause, order, order, topSessionPages)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		log.Println("Session pages query error:", err)
+		return nil, "Database error fetching entry and exit pages"
+	}
+	defer rows.Close()
+
+	pages := []SessionPage{}
+	for rows.Next() {
+		var page SessionPage
+		if err := rows.Scan(&page.Pathname, &page.Sessions); err != nil {
+			log.Println("Error scanning session page row:", err)
+			continue
+		}
+		pages = append(pages, page)
+	}
+	return pages, ""
+}
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"regexp"
+	"supametrics/db"
+	"supametrics/middleware"
+	"supametrics/models"
+	"supametrics/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	generatedSlugLength = 7
+	slugAlphabet        = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+var slugRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{3,64}$`)
+
+const shortLinkColumns = `
+	uuid, project_id, slug, destination_url, disabled, expires_at, created_at, updated_at
+`
+
+func scanShortLink(row interface{ Scan(...any) error }, link *models.ShortLink) error {
+	return row.Scan(
+		&link.UUID, &link.ProjectID, &link.Slug, &link.DestinationURL,
+		&link.Disabled, &link.ExpiresAt, &link.CreatedAt, &link.UpdatedAt,
+	)
+}
+
+func generateSlug() (string, error) {
+	slug := make([]byte, generatedSlugLength)
+	max := big.NewInt(int64(len(slugAlphabet)))
+	for i := range slug {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		slug[i] = slugAlphabet[n.Int64()]
+	}
+	return string(slug), nil
+}
+
+func validateShortLinkRequest(req models.ShortLinkRequest) string {
+	dest, err := url.Parse(req.DestinationURL)
+	if err != nil || (dest.Scheme != "http" && dest.Scheme != "https") || dest.Host == "" {
+		return "Invalid destination url"
+	}
+	if req.Slug != nil && !slugRegex.MatchString(*req.Slug) {
+		return "Slug must be 3-64 letters, numbers, dashes or underscores"
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		return "Expiry must be in the future"
+	}
+	return ""
+}
+
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
+
+// GetShortLinks lists the short links of a project
+func GetShortLinks(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM short_links
+		WHERE project_id = $1
+		ORDER BY created_at DESC;
+	`, shortLinkColumns)
+
+	rows, err := db.DB.Query(query, ctx.ProjectID)
+	if err != nil {
+		log.Println("Short links query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error fetching links"})
+	}
+	defer rows.Close()
+
+	links := []models.ShortLink{}
+	for rows.Next() {
+		var link models.ShortLink
+		if err := scanShortLink(rows, &link); err != nil {
+			log.Println("Error scanning short link row:", err)
+			continue
+		}
+		links = append(links, link)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Links fetched successfully",
+		"data":    links,
+	})
+}
+
+// CreateShortLink creates a short link, enforcing the daily per-plan limit
+func CreateShortLink(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	var req models.ShortLinkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid payload"})
+	}
+	if msg := validateShortLinkRequest(req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	// links that fail to be created give their quota back
+	releaseQuota := func() {}
+	if quota := utils.GetDailyLinkQuota(ctx.SubscriptionType); quota > 0 {
+		quotaKey := fmt.Sprintf("links:%s:%s", ctx.ProjectID, time.Now().UTC().Format("2006-01-02"))
+		if created, err := utils.IncrementCache("ratelimit", quotaKey, 24*time.Hour); err == nil {
+			releaseQuota = func() {
+				if err := utils.DecrementCache("ratelimit", quotaKey); err != nil {
+					log.Println("link quota release error:", err)
+				}
+			}
+			if created > quota {
+				releaseQuota()
+				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+					"message": "Daily link limit reached for your plan",
+				})
+			}
+		}
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO short_links (project_id, slug, destination_url, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING %s;
+	`, shortLinkColumns)
+
+	var link models.ShortLink
+	for attempt := 0; attempt < 3; attempt++ {
+		slug := ""
+		if req.Slug != nil {
+			slug = *req.Slug
+		} else {
+			generated, err := generateSlug()
+			if err != nil {
+				log.Println("slug generation error:", err)
+				releaseQuota()
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to create link"})
+			}
+			slug = generated
+		}
+
+		err := scanShortLink(db.DB.QueryRow(query, ctx.ProjectID, slug, req.DestinationURL, req.ExpiresAt), &link)
+		if err == nil {
+			return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+				"success": true,
+				"message": "Link created",
+				"data":    link,
+			})
+		}
+
+		if !isUniqueViolation(err) {
+			log.Println("Short link insert error:", err)
+			releaseQuota()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to create link"})
+		}
+
+		// custom slugs are not retried
+		if req.Slug != nil {
+			break
+		}
+	}
+
+	releaseQuota()
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Slug already taken"})
+}
+
+// UpdateShortLink replaces the destination, slug and expiry of a link
+func UpdateShortLink(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	linkID, err := uuid.Parse(c.Params("linkId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid link id"})
+	}
+
+	var req models.ShortLinkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid payload"})
+	}
+	if msg := validateShortLinkRequest(req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": msg})
+	}
+
+	var oldSlug string
+	err = db.DB.QueryRow(`SELECT slug FROM short_links WHERE uuid = $1 AND project_id = $2;`, linkID, ctx.ProjectID).Scan(&oldSlug)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Link not found"})
+	}
+	if err != nil {
+		log.Println("Short link query error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Database error fetching link"})
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE short_links
+		SET slug = COALESCE($3, slug),
+			destination_url = $4,
+			expires_at = $5,
+			updated_at = NOW()
+		WHERE uuid = $1 AND project_id = $2
+		RETURNING %s;
+	`, shortLinkColumns)
+
+	var link models.ShortLink
+	err = scanShortLink(db.DB.QueryRow(query, linkID, ctx.ProjectID, req.Slug, req.DestinationURL, req.ExpiresAt), &link)
+	if isUniqueViolation(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Slug already taken"})
+	}
+	if err != nil {
+		log.Println("Short link update error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to update link"})
+	}
+
+	_ = utils.DeleteCache("short_links", oldSlug)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Link updated",
+		"data":    link,
+	})
+}
+
+// DisableShortLink stops a link from redirecting, its clicks are kept
+func DisableShortLink(c *fiber.Ctx) error {
+	ctx, ok := c.Locals("project_ctx").(middleware.ProjectContext)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Project context missing"})
+	}
+
+	linkID, err := uuid.Parse(c.Params("linkId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid link id"})
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE short_links
+		SET disabled = true, updated_at = NOW()
+		WHERE uuid = $1 AND project_id = $2
+		RETURNING %s;
+	`, shortLinkColumns)
+
+	var link models.ShortLink
+	err = scanShortLink(db.DB.QueryRow(query, linkID, ctx.ProjectID), &link)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Link not found"})
+	}
+	if err != nil {
+		log.Println("Short link disable error:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to disable link"})
+	}
+
+	_ = utils.DeleteCache("short_links", link.Slug)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Link disabled",
+		"data":    link,
+	})
+}
+
+// RedirectShortLink resolves a slug, records the click and redirects
+func RedirectShortLink(c *fiber.Ctx) error {
+	slug := c.Params("slug")
+	if !slugRegex.MatchString(slug) {
+		return c.Status(fiber.StatusNotFound).SendString("Link not found")
+	}
+
+	var link models.ShortLink
+	if err := utils.GetCache("short_links", slug, &link); err != nil {
+		query := fmt.Sprintf(`SELECT %s FROM short_links WHERE slug = $1;`, shortLinkColumns)
+		err = scanShortLink(db.DB.QueryRow(query, slug), &link)
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).SendString("Link not found")
+		}
+		if err != nil {
+			log.Println("Short link query error:", err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Something went wrong")
+		}
+		_ = utils.SetCache("short_links", slug, link, 10*time.Minute)
+	}
+
+	if link.Disabled || (link.ExpiresAt != nil && link.ExpiresAt.Before(time.Now())) {
+		return c.Status(fiber.StatusGone).SendString("Link is no longer available")
+	}
+
+	req := models.AnalyticsEventRequest{
+		Pathname:    "/l/" + slug,
+		Hostname:    optionalString(c.Hostname()),
+		Referrer:    optionalString(c.Get(fiber.HeaderReferer)),
+		UTMSource:   optionalString(c.Query("utm_source")),
+		UTMMedium:   optionalString(c.Query("utm_medium")),
+		UTMCampaign: optionalString(c.Query("utm_campaign")),
+		UTMTerm:     optionalString(c.Query("utm_term")),
+		UTMContent:  optionalString(c.Query("utm_content")),
+		EventType:   "link_click",
+		EventName:   &slug,
+		EventData: map[string]any{
+			"link_id":     link.UUID.String(),
+			"destination": link.DestinationURL,
+		},
+	}
+
+	// never block the redirect on analytics, the click is saved afterwards
+	event, err := detachEvent(newAnalyticsEvent(c, link.ProjectID.String(), req))
+	if err != nil {
+		log.Println("link click copy error:", err)
+	} else {
+		go recordLinkClick(event)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Redirect(link.DestinationURL, fiber.StatusFound)
+}
+
+// recordLinkClick saves a click like an ingested event, it is dropped when
+// the project is over its monthly event quota
+func recordLinkClick(event models.AnalyticsEvent) {
+	projectID := event.ProjectID.String()
+
+	var subscriptionType string
+	err := db.DB.QueryRow(`
+		SELECT u.subscription_type
+		FROM projects p
+		JOIN "user" u ON p.user_id = u.uuid
+		WHERE p.uuid = $1;
+	`, projectID).Scan(&subscriptionType)
+	if err != nil {
+		log.Println("link click plan lookup error:", err)
+		return
+	}
+	if middleware.OverEventQuota(subscriptionType, middleware.MonthlyEventCount(projectID)) {
+		return
+	}
+
+	if _, err := saveAnalyticsEvent(event); err == nil {
+		incrementProjectEvents(projectID)
+	}
+}
+
+// detachEvent deep copies an event built from a request, the strings
+// fiber hands out point into buffers reused once the handler returns
+func detachEvent(event models.AnalyticsEvent) (models.AnalyticsEvent, error) {
+	var detached models.AnalyticsEvent
+	raw, err := json.Marshal(event)
+	if err != nil {
+		return detached, err
+	}
+	err = json.Unmarshal(raw, &detached)
+	return detached, err
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"supametrics/db"
+	"supametrics/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+var allowedFilters = []string{
+	"today",
+	"yesterday",
+	"thisweek",
+	"thismonth",
+	"thisyear",
+	"last7d",
+	"last30d",
+	"last12m",
+	"all",
+}
+
+// approximate bucket sizes, used to bound the number of buckets
+var intervals = map[string]time.Duration{
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+	"month":  30 * 24 * time.Hour,
+}
+
+// a day of minutes, or two months of hours
+const maxBuckets = 1500
+
+// TimeRange is the reporting period of a request, from a preset filter or
+// a custom from/to range. Days, weeks and buckets follow the project's
+// timezone, Start and End are kept in UTC like the stored timestamps.
+type TimeRange struct {
+	Filter    string    `json:"filter"`
+	Start     time.Time `json:"from"`
+	End       time.Time `json:"to"`
+	Interval  string    `json:"interval"`
+	Timezone  string    `json:"timezone"`
+	WeekStart string    `json:"weekStart"`
+
+	location *time.Location
+}
+
+func isAllowedFilter(filter string) bool {
+	for _, f := range allowedFilters {
+		if f == filter {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTimeRange reads the filter or from/to query params, the optional
+// interval and the tz override of the project's timezone. On failure the
+// returned message is meant for the client.
+func parseTimeRange(c *fiber.Ctx, projectID, defaultFilter string) (TimeRange, string) {
+	settings, err := utils.GetProjectSettings(projectID)
+	if err != nil {
+		log.Println("project settings error:", err)
+	}
+
+	tr := TimeRange{
+		Timezone:  c.Query("tz", settings.Timezone),
+		WeekStart: settings.WeekStart,
+	}
+	if tr.WeekStart != "sunday" {
+		tr.WeekStart = "monday"
+	}
+
+	tr.location, err = time.LoadLocation(tr.Timezone)
+	if err != nil || tr.Timezone == "" || tr.Timezone == "Local" {
+		return tr, "Invalid timezone provided, use an IANA name like Europe/Berlin"
+	}
+	now := time.Now().In(tr.location)
+
+	from, to := c.Query("from"), c.Query("to")
+	if from != "" || to != "" {
+		if from == "" || to == "" {
+			return tr, "Both from and to are required"
+		}
+
+		start, err := parseRangeDate(from, false, tr.location)
+		if err != nil {
+			return tr, "Invalid from date, use YYYY-MM-DD or RFC 3339"
+		}
+		end, err := parseRangeDate(to, true, tr.location)
+		if err != nil {
+			return tr, "Invalid to date, use YYYY-MM-DD or RFC 3339"
+		}
+		if !end.After(start) {
+			return tr, "to must be after from"
+		}
+
+		tr.Filter, tr.Start, tr.End = "custom", start, end
+	} else {
+		tr.Filter = c.Query("filter", defaultFilter)
+		if !isAllowedFilter(tr.Filter) {
+			return tr, "Invalid filter provided"
+		}
+		tr.Start, tr.End = presetRange(tr.Filter, now, tr.WeekStart, projectID)
+	}
+
+	// timestamps are stored in UTC without a zone, lib/pq would drop the offset
+	tr.Start, tr.End = tr.Start.UTC(), tr.End.UTC()
+
+	tr.Interval = c.Query("interval", defaultInterval(tr.Start, tr.End))
+	step, ok := intervals[tr.Interval]
+	if !ok {
+		return tr, "Invalid interval provided, use minute, hour, day, week or month"
+	}
+	if tr.End.Sub(tr.Start)/step > maxBuckets {
+		return tr, fmt.Sprintf("Interval too small for the range, at most %d buckets are allowed", maxBuckets)
+	}
+
+	return tr, ""
+}
+
+// parseRangeDate accepts a date, in the given location, or a full
+// timestamp. Dates used as the end of a range include the whole day.
+func parseRangeDate(value string, end bool, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", value, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		return endOfDay(day), nil
+	}
+	return day, nil
+}
+
+// presetRange computes a filter's boundaries in the location of now
+func presetRange(filter string, now time.Time, weekStart, projectID string) (time.Time, time.Time) {
+	switch filter {
+	case "yesterday":
+		y := now.AddDate(0, 0, -1)
+		return startOfDay(y), endOfDay(y)
+	case "thisweek":
+		start := startOfWeek(now, weekStart)
+		return start, endOfDay(start.AddDate(0, 0, 6))
+	case "thismonth":
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()), endOfMonth(now)
+	case "thisyear":
+		return time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, now.Location()), endOfYear(now)
+	case "last7d":
+		return startOfDay(now.AddDate(0, 0, -6)), endOfDay(now)
+	case "last30d":
+		return startOfDay(now.AddDate(0, 0, -29)), endOfDay(now)
+	case "last12m":
+		return time.Date(now.Year(), now.Month()-11, 1, 0, 0, 0, 0, now.Location()), endOfMonth(now)
+	case "all":
+		start := startOfDay(now)
+		if first, ok := firstDataDate(projectID); ok && first.Before(start) {
+			start = startOfDay(first.In(now.Location()))
+		}
+		return start, endOfDay(now)
+	default: // today
+		return startOfDay(now), endOfDay(now)
+	}
+}
+
+// defaultInterval keeps the bucket count readable for the range length
+func defaultInterval(start, end time.Time) string {
+	switch span := end.Sub(start); {
+	case span <= 48*time.Hour:
+		return "hour"
+	case span <= 92*24*time.Hour:
+		return "day"
+	default:
+		return "month"
+	}
+}
+
+// Location is where the range's days and buckets start
+func (tr TimeRange) Location() *time.Location {
+	if tr.location == nil {
+		return time.UTC
+	}
+	return tr.location
+}
+
+// bucketSQL truncates a UTC timestamp column to the range's interval in
+// its timezone, e.g. days start at local midnight. The buckets are
+// returned as instants, scan them with Location to show local times.
+func (tr TimeRange) bucketSQL(column string) string {
+	return tr.truncSQL(fmt.Sprintf("((%s AT TIME ZONE 'UTC') AT TIME ZONE %s)", column, pq.QuoteLiteral(tr.Location().String())))
+}
+
+// truncSQL truncates a local wall clock expression to the range's interval
+// and converts it to an instant
+func (tr TimeRange) truncSQL(local string) string {
+	trunc := fmt.Sprintf("date_trunc('%s', %s)", tr.Interval, local)
+	if tr.Interval == "week" && tr.WeekStart == "sunday" {
+		// date_trunc weeks start on Monday
+		trunc = fmt.Sprintf("(date_trunc('week', %s + interval '1 day') - interval '1 day')", local)
+	}
+	return fmt.Sprintf("(%s AT TIME ZONE %s)", trunc, pq.QuoteLiteral(tr.Location().String()))
+}
+
+// buckets lists the start of every bucket in the range, in its timezone,
+// matching the buckets of bucketSQL
+func (tr TimeRange) buckets() []time.Time {
+	loc := tr.Location()
+	end := tr.End.In(loc)
+
+	var buckets []time.Time
+	for t := tr.truncate(tr.Start.In(loc)); !t.After(end); t = tr.next(t) {
+		buckets = append(buckets, t)
+	}
+	return buckets
+}
+
+// fillBuckets adds the buckets a series has no data for, with 0 visits
+func (tr TimeRange) fillBuckets(frequency []FrequencyData) []FrequencyData {
+	byTime := make(map[int64]FrequencyData, len(frequency))
+	for _, fd := range frequency {
+		byTime[fd.Time.Unix()] = fd
+	}
+
+	buckets := tr.buckets()
+	filled := make([]FrequencyData, 0, len(buckets))
+	for _, t := range buckets {
+		fd, ok := byTime[t.Unix()]
+		if !ok {
+			fd = FrequencyData{Time: t}
+		}
+		filled = append(filled, fd)
+	}
+	return filled
+}
+
+// alignBuckets cuts a filled series to n buckets, or pads it with empty
+// buckets following its last one, so it lines up with another series
+func (tr TimeRange) alignBuckets(frequency []FrequencyData, n int) []FrequencyData {
+	if len(frequency) >= n {
+		return frequency[:n]
+	}
+
+	t := tr.truncate(tr.Start.In(tr.Location()))
+	if len(frequency) > 0 {
+		t = tr.next(frequency[len(frequency)-1].Time)
+	}
+	for len(frequency) < n {
+		frequency = append(frequency, FrequencyData{Time: t})
+		t = tr.next(t)
+	}
+	return frequency
+}
+
+func (tr TimeRange) truncate(t time.Time) time.Time {
+	switch tr.Interval {
+	case "minute":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, t.Location())
+	case "hour":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case "week":
+		return startOfWeek(t, tr.WeekStart)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	default:
+		return startOfDay(t)
+	}
+}
+
+func (tr TimeRange) next(t time.Time) time.Time {
+	switch tr.Interval {
+	case "minute":
+		return t.Add(time.Minute)
+	case "hour":
+		return t.Add(time.Hour)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek returns the start of t's week, weeks start on Monday unless
+// weekStart is "sunday"
+func startOfWeek(t time.Time, weekStart string) time.Time {
+	firstDay := time.Monday
+	if weekStart == "sunday" {
+		firstDay = time.Sunday
+	}
+	daysIntoWeek := int(t.Weekday() - firstDay)
+	if daysIntoWeek < 0 {
+		daysIntoWeek += 7
+	}
+	return startOfDay(t.AddDate(0, 0, -daysIntoWeek))
+}
+
+func endOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 999000000, t.Location())
+}
+
+func endOfMonth(t time.Time) time.Time {
+	y, m, _ := t.Date()
+	return time.Date(y, m+1, 0, 23, 59, 59, 999000000, t.Location())
+}
+
+func endOfYear(t time.Time) time.Time {
+	return time.Date(t.Year(), time.December, 31, 23, 59, 59, 999000000, t.Location())
+}
+
+// firstDataDate returns the day of a project's first event or imported
+// stat, the start of the "all" range
+func firstDataDate(projectID string) (time.Time, bool) {
+	var first time.Time
+	if err := utils.GetCache("first_data", projectID, &first); err == nil {
+		return first, !first.IsZero()
+	}
+
+	var firstData sql.NullTime
+	err := db.DB.QueryRow(`
+		SELECT LEAST(
+			(SELECT MIN(timestamp) FROM analytics_events WHERE project_id = $1),
+			(SELECT MIN(date)::timestamp FROM imported_stats WHERE project_id = $1)
+		);
+	`, projectID).Scan(&firstData)
+	if err != nil {
+		log.Println("first data query error:", err)
+		return time.Time{}, false
+	}
+
+	// no data yet isn't cached, the first event must show up right away
+	if !firstData.Valid {
+		return time.Time{}, false
+	}
+
+	first = startOfDay(firstData.Time.UTC())
+	_ = utils.SetCache("first_data", projectID, first, time.Hour)
+	return first, true
+}
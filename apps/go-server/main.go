@@ -3,18 +3,28 @@ package main
 import (
 	"log"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
+	_ "time/tzdata" // project timezones must load without system zoneinfo
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/joho/godotenv"
 
 	"supametrics/db"
+	"supametrics/geo"
 	"supametrics/handlers"
 	"supametrics/middleware"
+	"supametrics/uaparser"
 	"supametrics/utils"
 )
 
+// historical imports are uploaded as files, every other route keeps
+// fiber's default body limit
+const maxImportUploadSize = 100 * 1024 * 1024
+
 func main() {
 	err := godotenv.Load()
 	if err != nil {
@@ -26,19 +36,45 @@ func main() {
 	}
 	defer db.Close()
 
-	geoDBPath := os.Getenv("IP2LOCATION_DB_PATH")
-	if geoDBPath == "" {
-		log.Println("WARNING: IP2LOCATION_DB_PATH not set. GeoIP lookups will use fallbacks.")
-	} else {
-		if err := handlers.InitGeoDB(geoDBPath); err != nil {
-			log.Fatalf("FATAL: Failed to initialize MaxMind GeoIP database: %v", err)
-		}
+	if err := geo.Init(); err != nil {
+		log.Fatalf("FATAL: Failed to initialize GeoIP database: %v", err)
 	}
+	defer geo.Close()
+
+	if err := uaparser.Init(); err != nil {
+		log.Println("User agent rules not loaded, using the built-in rules:", err)
+	}
+
+	// pick up GeoIP database and user agent rule updates without a restart
+	geo.Watch(time.Minute)
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := geo.Reload(); err != nil {
+				log.Println("GeoIP reload failed, keeping current databases:", err)
+			}
+			if err := uaparser.Reload(); err != nil {
+				log.Println("User agent rules reload failed, keeping current rules:", err)
+			}
+		}
+	}()
+
+	handlers.StartImportHeartbeat()
+	handlers.StartDeadLetterWorker()
 
+	// bodies over the default limit are streamed, LimitBody decides which
+	// routes may send them
 	app := fiber.New(fiber.Config{
-		ProxyHeader: fiber.HeaderXForwardedFor,
+		ProxyHeader:                  fiber.HeaderXForwardedFor,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
 	})
 
+	app.Use(middleware.LimitBody(fiber.DefaultBodyLimit, map[string]int{
+		"/api/v1/imports": maxImportUploadSize,
+	}))
+
 	clientUrls := os.Getenv("APP_URL")
 
 	// split comma-separated URLs into a slice
@@ -47,7 +83,15 @@ func main() {
 		allowedOrigins[i] = strings.TrimSuffix(strings.TrimSpace(origin), "/")
 	}
 
+	// ingestion is called from any site running the tracker
+	publicPaths := map[string]bool{
+		"/api/v1/analytics/log": true,
+	}
+
 	app.Use(cors.New(cors.Config{
+		Next: func(c *fiber.Ctx) bool {
+			return publicPaths[c.Path()]
+		},
 		AllowOriginsFunc: func(origin string) bool {
 			requestOrigin := strings.TrimSuffix(origin, "/")
 
@@ -63,10 +107,18 @@ func main() {
 			}
 			return false
 		},
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-Private-Key, X-Forwarded-For, X-Public-Key",
-		AllowMethods: "GET, POST, PUT, HEAD, OPTIONS",
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-Private-Key, X-Forwarded-For, X-Public-Key, X-Admin-Key",
+		AllowMethods: "GET, POST, PUT, DELETE, HEAD, OPTIONS",
 	}))
 
+	for path := range publicPaths {
+		app.Use(path, cors.New(cors.Config{
+			AllowOrigins: "*",
+			AllowHeaders: "Origin, Content-Type, Accept, X-Public-Key",
+			AllowMethods: "POST, OPTIONS",
+		}))
+	}
+
 	app.Use(func(c *fiber.Ctx) error {
 		ip := utils.GetRealClientIP(c)
 		c.Locals("clientIP", ip)
@@ -79,6 +131,10 @@ func main() {
 		})
 	})
 
+	app.Get("/script.js", handlers.ServeTrackerScript)
+	app.Get("/js/:publicKey.js", handlers.ServeProjectTrackerScript)
+	app.Get("/l/:slug", handlers.RedirectShortLink)
+
 	v1 := app.Group("/api/v1")
 
 	v1.Get("/health", func(c *fiber.Ctx) error {
@@ -90,8 +146,42 @@ func main() {
 	v1.Post("/analytics/log", middleware.VerifyPublicKey, handlers.LogAnalyticsEvent)
 
 	v1.Get("/analytics/project", middleware.VerifyPrivateKey, handlers.GetAnalytics)
+	v1.Get("/analytics/project/issues", middleware.VerifyPrivateKey, handlers.GetIssues)
+	v1.Get("/analytics/project/issues/:issueId", middleware.VerifyPrivateKey, handlers.GetIssueTrend)
+	v1.Get("/analytics/project/locations", middleware.VerifyPrivateKey, handlers.GetLocations)
+	v1.Get("/analytics/project/screens", middleware.VerifyPrivateKey, handlers.GetScreens)
+	v1.Get("/analytics/project/events", middleware.VerifyPrivateKey, handlers.GetEvents)
+	v1.Get("/analytics/project/export", middleware.VerifyPrivateKey, handlers.ExportEvents)
+	v1.Post("/analytics/project/funnels", middleware.VerifyPrivateKey, handlers.PostFunnel)
+	v1.Get("/analytics/project/retention", middleware.VerifyPrivateKey, handlers.GetRetention)
+	v1.Get("/analytics/project/paths", middleware.VerifyPrivateKey, handlers.GetPaths)
+	v1.Get("/analytics/project/realtime", middleware.VerifyPrivateKey, handlers.GetRealtime)
+	v1.Get("/analytics/project/live", middleware.VerifyPrivateKey, handlers.StreamLiveEvents)
+	v1.Get("/analytics/project/goals", middleware.VerifyPrivateKey, handlers.GetGoalConversions)
+	v1.Get("/analytics/project/goals/:goalId", middleware.VerifyPrivateKey, handlers.GetGoalReport)
+	v1.Get("/analytics/project/breakdown/:dimension", middleware.VerifyPrivateKey, handlers.GetBreakdown)
 	v1.Get("/analytics/project/:eventName", middleware.VerifyPrivateKey, handlers.GetAnalytics)
 
+	v1.Get("/links", middleware.VerifyPrivateKey, handlers.GetShortLinks)
+	v1.Post("/links", middleware.VerifyPrivateKey, handlers.CreateShortLink)
+	v1.Put("/links/:linkId", middleware.VerifyPrivateKey, handlers.UpdateShortLink)
+	v1.Post("/links/:linkId/disable", middleware.VerifyPrivateKey, handlers.DisableShortLink)
+
+	v1.Get("/goals", middleware.VerifyPrivateKey, handlers.GetGoals)
+	v1.Post("/goals", middleware.VerifyPrivateKey, handlers.CreateGoal)
+	v1.Put("/goals/:goalId", middleware.VerifyPrivateKey, handlers.UpdateGoal)
+	v1.Delete("/goals/:goalId", middleware.VerifyPrivateKey, handlers.DeleteGoal)
+
+	v1.Post("/imports", middleware.VerifyPrivateKey, handlers.CreateImport)
+	v1.Get("/imports/:importId", middleware.VerifyPrivateKey, handlers.GetImport)
+	v1.Post("/imports/:importId/rollback", middleware.VerifyPrivateKey, handlers.RollbackImport)
+
+	admin := v1.Group("/admin", middleware.VerifyAdminKey)
+	admin.Get("/metrics", handlers.GetMetrics)
+	admin.Get("/dead-letters", handlers.GetDeadLetters)
+	admin.Post("/dead-letters/replay", handlers.ReplayDeadLetters)
+	admin.Get("/geoip", handlers.GetGeoIPInfo)
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "3005"
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// VerifyAdminKey guards operator endpoints with the ADMIN_API_KEY env.
+// The endpoints are disabled when it is not set.
+func VerifyAdminKey(c *fiber.Ctx) error {
+	adminKey := os.Getenv("ADMIN_API_KEY")
+	if adminKey == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Not found",
+		})
+	}
+
+	provided := c.Get("X-Admin-Key")
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(adminKey)) != 1 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Invalid admin key",
+		})
+	}
+
+	return c.Next()
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LimitBody rejects request bodies larger than limit, or than the limit
+// set for their path in overrides. It needs StreamRequestBody, bodies over
+// the server's BodyLimit are then left unread for the handler to stream.
+func LimitBody(limit int, overrides map[string]int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		max := limit
+		if override, ok := overrides[c.Path()]; ok {
+			max = override
+		}
+
+		req := c.Request()
+		length := req.Header.ContentLength()
+		if length > max {
+			// the unread body can't be skipped, so the connection is dropped
+			c.Context().SetConnectionClose()
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"message": "Request body too large",
+			})
+		}
+
+		// chunked bodies have no length up front, so read at most max of them
+		if length == -1 && req.IsBodyStream() {
+			body, err := io.ReadAll(io.LimitReader(c.Context().RequestBodyStream(), int64(max)+1))
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid request body"})
+			}
+			if len(body) > max {
+				c.Context().SetConnectionClose()
+				return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+					"message": "Request body too large",
+				})
+			}
+			req.SetBody(body)
+		}
+
+		return c.Next()
+	}
+}
@@ -94,7 +94,8 @@ func VerifyPrivateKey(c *fiber.Ctx) error {
 			SELECT COUNT(*) 
 			FROM analytics_events
 			WHERE project_id = $1
-			  AND timestamp >= $2;
+			  AND timestamp >= $2
+			  AND import_id IS NULL;
 		`
 		err = db.DB.QueryRow(countQuery, ctx.ProjectID, startOfMonth).Scan(&ctx.TotalEvents)
 		if err != nil {
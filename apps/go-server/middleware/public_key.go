@@ -96,31 +96,9 @@ func VerifyPublicKey(c *fiber.Ctx) error {
 		}
 	}
 
-	now := time.Now()
-	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
-
-	cacheKey := fmt.Sprintf("events:%s:%s", ctx.ProjectID, startOfMonth.Format("2006-01"))
-	var cachedCount int
-	if err := utils.GetCache("project_events", cacheKey, &cachedCount); err == nil {
-		ctx.TotalEvents = cachedCount
-	} else {
-		countQuery := `
-			SELECT COUNT(*) 
-			FROM analytics_events
-			WHERE project_id = $1
-			  AND timestamp >= $2;
-		`
-		err = db.DB.QueryRow(countQuery, ctx.ProjectID, startOfMonth).Scan(&ctx.TotalEvents)
-		if err != nil {
-			log.Println("db count error:", err)
-			ctx.TotalEvents = 0
-		}
-		_ = utils.SetCache("project_events", cacheKey, ctx.TotalEvents, time.Minute)
-	}
+	ctx.TotalEvents = MonthlyEventCount(ctx.ProjectID)
 
-	quota := utils.GetQuota(ctx.SubscriptionType)
-
-	if quota > 0 && ctx.TotalEvents > quota {
+	if OverEventQuota(ctx.SubscriptionType, ctx.TotalEvents) {
 		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
 			"message": "Event quota exceeded for this project",
 		})
@@ -130,3 +108,36 @@ func VerifyPublicKey(c *fiber.Ctx) error {
 	c.Locals("project_ctx", ctx)
 	return c.Next()
 }
+
+// MonthlyEventCount counts the events a project sent this month, imported
+// ones excluded. The count is cached for a minute.
+func MonthlyEventCount(projectID string) int {
+	now := time.Now()
+	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	cacheKey := fmt.Sprintf("events:%s:%s", projectID, startOfMonth.Format("2006-01"))
+	var count int
+	if err := utils.GetCache("project_events", cacheKey, &count); err == nil {
+		return count
+	}
+
+	countQuery := `
+		SELECT COUNT(*) 
+		FROM analytics_events
+		WHERE project_id = $1
+		  AND timestamp >= $2
+		  AND import_id IS NULL;
+	`
+	if err := db.DB.QueryRow(countQuery, projectID, startOfMonth).Scan(&count); err != nil {
+		log.Println("db count error:", err)
+		count = 0
+	}
+	_ = utils.SetCache("project_events", cacheKey, count, time.Minute)
+	return count
+}
+
+// OverEventQuota reports whether a plan's monthly event quota is used up
+func OverEventQuota(subscriptionType string, totalEvents int) bool {
+	quota := utils.GetQuota(subscriptionType)
+	return quota > 0 && totalEvents > quota
+}
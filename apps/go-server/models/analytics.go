@@ -13,6 +13,7 @@ type AnalyticsEvent struct {
 	ProjectID      uuid.UUID      `json:"project_id" db:"project_id"`
 	SessionID      string         `json:"session_id" db:"session_id"`
 	VisitorID      *string        `json:"visitor_id,omitempty" db:"visitor_id"`
+	UserID         *string        `json:"user_id,omitempty" db:"user_id"`
 	Timestamp      time.Time      `json:"timestamp" db:"timestamp"`
 	Pathname       string         `json:"pathname" db:"pathname"`
 	Referrer       *string        `json:"referrer,omitempty" db:"referrer"`
@@ -23,7 +24,18 @@ type AnalyticsEvent struct {
 	UTMTerm        *string        `json:"utm_term,omitempty" db:"utm_term"`
 	UTMContent     *string        `json:"utm_content,omitempty" db:"utm_content"`
 	Country        *string        `json:"country" db:"country"`
+	CountryName    *string        `json:"country_name,omitempty" db:"country_name"`
+	Continent      *string        `json:"continent,omitempty" db:"continent"`
 	City           *string        `json:"city" db:"city"`
+	Region         *string        `json:"region,omitempty" db:"region"`
+	PostalCode     *string        `json:"postal_code,omitempty" db:"postal_code"`
+	Latitude       *float64       `json:"latitude,omitempty" db:"latitude"`
+	Longitude      *float64       `json:"longitude,omitempty" db:"longitude"`
+	Timezone       *string        `json:"timezone,omitempty" db:"timezone"`
+	ISP            *string        `json:"isp,omitempty" db:"isp"`
+	ASN            *int           `json:"asn,omitempty" db:"asn"`
+	ASOrganization *string        `json:"as_organization,omitempty" db:"as_organization"`
+	Datacenter     bool           `json:"datacenter" db:"datacenter"`
 	EventType      string         `json:"event_type" db:"event_type"`
 	EventName      *string        `json:"event_name,omitempty" db:"event_name"`
 	EventData      map[string]any `json:"event_data,omitempty" db:"event_data"`
@@ -32,8 +44,16 @@ type AnalyticsEvent struct {
 	OSName         *string        `json:"os_name,omitempty" db:"os_name"`
 	OSVersion      *string        `json:"os_version,omitempty" db:"os_version"`
 	DeviceType     *string        `json:"device_type,omitempty" db:"device_type"`
+	DeviceVendor   *string        `json:"device_vendor,omitempty" db:"device_vendor"`
+	DeviceModel    *string        `json:"device_model,omitempty" db:"device_model"`
+	ScreenWidth    *int           `json:"screen_width,omitempty" db:"screen_width"`
+	ScreenHeight   *int           `json:"screen_height,omitempty" db:"screen_height"`
+	ScreenSize     *string        `json:"screen_size,omitempty" db:"screen_size"`
+	ViewportWidth  *int           `json:"viewport_width,omitempty" db:"viewport_width"`
+	Language       *string        `json:"language,omitempty" db:"language"`
 	UserAgent      *string        `json:"user_agent,omitempty" db:"user_agent"`
 	Duration       *int           `json:"duration,omitempty" db:"duration"`
+	ImportID       *uuid.UUID     `json:"import_id,omitempty" db:"import_id"`
 }
 
 type AnalyticsEventRequest struct {
@@ -51,5 +71,33 @@ type AnalyticsEventRequest struct {
 	EventName *string        `json:"event_name,omitempty"`
 	EventData map[string]any `json:"event_data,omitempty"`
 
+	// set by the site for signed in users, see supametrics.identify
+	UserID *string `json:"user_id,omitempty"`
+
+	// only used when event_type is "error"
+	Error *ErrorDetails `json:"error,omitempty"`
+
 	Duration *int `json:"duration,omitempty"`
+
+	ScreenWidth   *int    `json:"screen_width,omitempty"`
+	ScreenHeight  *int    `json:"screen_height,omitempty"`
+	ViewportWidth *int    `json:"viewport_width,omitempty"`
+	Language      *string `json:"language,omitempty"`
+
+	// high entropy Client Hints, which cross-origin requests don't send as headers
+	ClientHints *ClientHints `json:"client_hints,omitempty"`
+}
+
+// ClientHints are collected by the tracker through navigator.userAgentData
+type ClientHints struct {
+	Platform        string            `json:"platform,omitempty"`
+	PlatformVersion string            `json:"platform_version,omitempty"`
+	Model           string            `json:"model,omitempty"`
+	Mobile          *bool             `json:"mobile,omitempty"`
+	FullVersionList []ClientHintBrand `json:"full_version_list,omitempty"`
+}
+
+type ClientHintBrand struct {
+	Brand   string `json:"brand"`
+	Version string `json:"version"`
 }
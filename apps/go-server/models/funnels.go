@@ -0,0 +1,15 @@
+package models
+
+type FunnelStep struct {
+	Name      string  `json:"name,omitempty"`
+	EventName *string `json:"event_name,omitempty"`
+	Pathname  *string `json:"pathname,omitempty"` // "*" matches any characters, e.g. /blog/*
+	Filters   string  `json:"filters,omitempty"`  // same syntax as the filters query parameter
+}
+
+type FunnelRequest struct {
+	Steps   []FunnelStep `json:"steps" validate:"required"`
+	Order   string       `json:"order,omitempty"`    // "loose" (default) or "strict"
+	Window  string       `json:"window,omitempty"`   // e.g. "30m", "24h" or "7d", defaults to "24h"
+	CountBy string       `json:"count_by,omitempty"` // "visitor" (default) or "session"
+}
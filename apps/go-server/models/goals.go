@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Goal represents a record from goals table
+type Goal struct {
+	ID              int       `json:"id" db:"id"`
+	UUID            uuid.UUID `json:"uuid" db:"uuid"`
+	ProjectID       uuid.UUID `json:"project_id" db:"project_id"`
+	Name            string    `json:"name" db:"name"`
+	Type            string    `json:"type" db:"type"` // pageview, event or revenue
+	Pathname        *string   `json:"pathname,omitempty" db:"pathname"`
+	EventName       *string   `json:"event_name,omitempty" db:"event_name"`
+	Filters         string    `json:"filters" db:"filters"`
+	RevenueProperty *string   `json:"revenue_property,omitempty" db:"revenue_property"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type GoalRequest struct {
+	Name      string  `json:"name" validate:"required"`
+	Type      string  `json:"type" validate:"required"`
+	Pathname  *string `json:"pathname,omitempty"`   // "*" matches any characters, e.g. /thanks/*
+	EventName *string `json:"event_name,omitempty"` // required for event and revenue goals
+	Filters   string  `json:"filters,omitempty"`    // same syntax as the analytics filters
+	// event_data key of the amount for revenue goals, "revenue" by default
+	RevenueProperty *string `json:"revenue_property,omitempty"`
+}
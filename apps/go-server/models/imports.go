@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ImportJob represents a record from import_jobs table
+type ImportJob struct {
+	ID            int              `json:"id" db:"id"`
+	UUID          uuid.UUID        `json:"uuid" db:"uuid"`
+	ProjectID     uuid.UUID        `json:"project_id" db:"project_id"`
+	Format        string           `json:"format" db:"format"`
+	Filename      string           `json:"filename" db:"filename"`
+	Status        string           `json:"status" db:"status"`
+	Enrich        bool             `json:"enrich" db:"enrich"`
+	ProcessedRows int              `json:"processed_rows" db:"processed_rows"`
+	ImportedRows  int              `json:"imported_rows" db:"imported_rows"`
+	FailedRows    int              `json:"failed_rows" db:"failed_rows"`
+	Errors        []ImportRowError `json:"errors" db:"errors"`
+	CreatedAt     time.Time        `json:"created_at" db:"created_at"`
+	FinishedAt    *time.Time       `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// ImportRowError describes a row that could not be imported
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+const (
+	ImportStatusPending    = "pending"
+	ImportStatusRunning    = "running"
+	ImportStatusCompleted  = "completed"
+	ImportStatusFailed     = "failed"
+	ImportStatusRolledBack = "rolled_back"
+)
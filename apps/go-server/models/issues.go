@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrorDetails is the payload sent with an `error` event
+type ErrorDetails struct {
+	Message string  `json:"message" validate:"required"`
+	Stack   *string `json:"stack,omitempty"`
+	Source  *string `json:"source,omitempty"`
+	Line    *int    `json:"line,omitempty"`
+	Column  *int    `json:"column,omitempty"`
+	Release *string `json:"release,omitempty"`
+}
+
+// Issue represents a record from issues table, one per error fingerprint
+type Issue struct {
+	ID               int       `json:"id" db:"id"`
+	UUID             uuid.UUID `json:"uuid" db:"uuid"`
+	ProjectID        uuid.UUID `json:"project_id" db:"project_id"`
+	Fingerprint      string    `json:"fingerprint" db:"fingerprint"`
+	Message          string    `json:"message" db:"message"`
+	Stack            *string   `json:"stack,omitempty" db:"stack"`
+	SourceFile       *string   `json:"source_file,omitempty" db:"source_file"`
+	LineNumber       *int      `json:"line_number,omitempty" db:"line_number"`
+	ColumnNumber     *int      `json:"column_number,omitempty" db:"column_number"`
+	Release          *string   `json:"release,omitempty" db:"release"`
+	FirstSeen        time.Time `json:"first_seen" db:"first_seen"`
+	LastSeen         time.Time `json:"last_seen" db:"last_seen"`
+	Occurrences      int       `json:"occurrences" db:"occurrences"`
+	AffectedVisitors int       `json:"affected_visitors" db:"affected_visitors"`
+}
@@ -0,0 +1,27 @@
+package models
+
+// ProjectSettings represents a record from project_settings table.
+// Projects without a row use DefaultProjectSettings.
+type ProjectSettings struct {
+	ProjectID       string   `json:"project_id" db:"project_id"`
+	HashRouting     bool     `json:"hash_routing" db:"hash_routing"`
+	TrackOutbound   bool     `json:"track_outbound" db:"track_outbound"`
+	ExcludedPaths   []string `json:"excluded_paths" db:"excluded_paths"`
+	GeoPrecision    string   `json:"geo_precision" db:"geo_precision"`
+	Locale          string   `json:"locale" db:"locale"`
+	Timezone        string   `json:"timezone" db:"timezone"`
+	WeekStart       string   `json:"week_start" db:"week_start"`
+	VisitorStrategy string   `json:"visitor_strategy" db:"visitor_strategy"`
+}
+
+func DefaultProjectSettings(projectID string) ProjectSettings {
+	return ProjectSettings{
+		ProjectID:       projectID,
+		ExcludedPaths:   []string{},
+		GeoPrecision:    "city",
+		Locale:          "en",
+		Timezone:        "UTC",
+		WeekStart:       "monday",
+		VisitorStrategy: "daily",
+	}
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShortLink represents a record from short_links table
+type ShortLink struct {
+	ID             int        `json:"id" db:"id"`
+	UUID           uuid.UUID  `json:"uuid" db:"uuid"`
+	ProjectID      uuid.UUID  `json:"project_id" db:"project_id"`
+	Slug           string     `json:"slug" db:"slug"`
+	DestinationURL string     `json:"destination_url" db:"destination_url"`
+	Disabled       bool       `json:"disabled" db:"disabled"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+type ShortLinkRequest struct {
+	Slug           *string    `json:"slug,omitempty"`
+	DestinationURL string     `json:"destination_url" validate:"required"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,36 @@
+package tracker
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+)
+
+//go:embed tracker.min.js
+var source []byte
+
+var placeholder = []byte("__SUPAMETRICS_CONFIG__")
+
+// Config is baked into the served tracker script.
+// Empty Key means the script reads it from the data-key attribute.
+type Config struct {
+	Endpoint      string   `json:"endpoint"`
+	Key           string   `json:"key,omitempty"`
+	HashRouting   bool     `json:"hashRouting"`
+	TrackOutbound bool     `json:"trackOutbound"`
+	ExcludedPaths []string `json:"excludedPaths"`
+}
+
+// Render returns the tracker script with cfg injected.
+func Render(cfg Config) ([]byte, error) {
+	if cfg.ExcludedPaths == nil {
+		cfg.ExcludedPaths = []string{}
+	}
+
+	rawConfig, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.Replace(source, placeholder, rawConfig, 1), nil
+}
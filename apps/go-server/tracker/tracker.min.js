@@ -0,0 +1 @@
+!function(w,d){"use strict";var c=__SUPAMETRICS_CONFIG__,s=d.currentScript,l=w.location,h=w.history,n=null,H=n,I=n;function a(k){return s&&s.getAttribute("data-"+k)}if(!c.key)c.key=a("key");if(!c.key)return;if(a("hash-routing")!==n)c.hashRouting=a("hash-routing")!=="false";if(a("outbound")!==n)c.trackOutbound=a("outbound")!=="false";if(a("exclude"))c.excludedPaths=a("exclude").split(",");var x=(c.excludedPaths||[]).map(function(p){return new RegExp("^"+p.trim().replace(/[.+?^${}()|[\]\\]/g,"\\$&").replace(/\*\*/g,".__").replace(/\*/g,"[^/]*").replace(/\.__/g,".*")+"$")});function p(){return c.hashRouting?l.pathname+l.hash:l.pathname}function e(t){for(var i=0;i<x.length;i++)if(x[i].test(t))return!0;return!1}function q(k){try{return new URLSearchParams(l.search).get(k)}catch(r){return n}}function t(y,m,v){var u=p();if(e(u)||w.__supametricsOff)return;var b={pathname:u,referrer:d.referrer||n,hostname:l.hostname,utm_source:q("utm_source"),utm_medium:q("utm_medium"),utm_campaign:q("utm_campaign"),utm_term:q("utm_term"),utm_content:q("utm_content"),event_type:y,event_name:m||n,event_data:v||n,screen_width:w.screen&&screen.width,screen_height:w.screen&&screen.height,viewport_width:w.innerWidth,language:navigator.language||n,client_hints:H,user_id:I};try{fetch(c.endpoint,{method:"POST",headers:{"Content-Type":"application/json","X-Public-Key":c.key},body:JSON.stringify(b),keepalive:!0}).catch(function(){})}catch(r){}}var o;function g(){var u=p();if(u===o)return;o=u;t("pageview")}if(h.pushState){var f=h.pushState;h.pushState=function(){f.apply(this,arguments);g()};w.addEventListener("popstate",g)}if(c.hashRouting)w.addEventListener("hashchange",g);if(c.trackOutbound)d.addEventListener("click",function(r){var k=r.target&&r.target.closest&&r.target.closest("a[href]");if(k&&k.host&&k.host!==l.host)t("event","outbound_link",{url:k.href})},!0);w.supametrics={track:function(m,v){t("event",m,v)},identify:function(i){I=i==n?n:String(i)}};function S(){d.visibilityState==="prerender"?d.addEventListener("visibilitychange",g,{once:!0}):g()}var U=navigator.userAgentData;U&&U.getHighEntropyValues?U.getHighEntropyValues(["platformVersion","model","fullVersionList"]).then(function(r){H={platform:r.platform,platform_version:r.platformVersion,model:r.model,mobile:r.mobile,full_version_list:r.fullVersionList}},function(){}).then(S):S()}(window,document);
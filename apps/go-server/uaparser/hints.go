@@ -0,0 +1,198 @@
+package uaparser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxHintBrands bounds the brand lists of hints, tracker collected ones
+// come from the request body and can't be trusted
+const MaxHintBrands = 16
+
+// Brand is an entry of the Sec-CH-UA brand lists
+type Brand struct {
+	Brand   string `json:"brand"`
+	Version string `json:"version"`
+}
+
+// ClientHints are the User-Agent Client Hints of a request, from the
+// Sec-CH-UA-* headers or collected by the tracker through
+// navigator.userAgentData. Empty fields were not sent.
+type ClientHints struct {
+	Brands          []Brand
+	FullVersionList []Brand
+	Mobile          *bool
+	Platform        string
+	PlatformVersion string
+	Model           string
+}
+
+var (
+	brandItem = regexp.MustCompile(`"([^"]*)"\s*;\s*v\s*=\s*"([^"]*)"`)
+
+	// browsers add a fake brand, e.g. "Not A(Brand", so lists can't be matched exactly
+	greaseBrand = regexp.MustCompile(`(?i)not.?a.?brand`)
+)
+
+// brandNames maps Client Hint brands to the names the UA rules use
+var brandNames = map[string]string{
+	"Google Chrome":    "Chrome",
+	"Microsoft Edge":   "Edge",
+	"Opera":            "Opera",
+	"Opera GX":         "Opera",
+	"Brave":            "Brave",
+	"Samsung Internet": "Samsung Internet",
+	"YaBrowser":        "Yandex",
+	"Yandex":           "Yandex",
+	"Vivaldi":          "Vivaldi",
+	"Chromium":         "Chromium",
+}
+
+var platformNames = map[string]string{
+	"Windows":     "Windows",
+	"macOS":       "macOS",
+	"Android":     "Android",
+	"iOS":         "iOS",
+	"Chrome OS":   "Chrome OS",
+	"Chromium OS": "Chrome OS",
+	"Linux":       "Linux",
+}
+
+// ParseBrandList parses a Sec-CH-UA or Sec-CH-UA-Full-Version-List header
+func ParseBrandList(header string) []Brand {
+	var brands []Brand
+	for _, match := range brandItem.FindAllStringSubmatch(header, -1) {
+		brands = append(brands, Brand{Brand: match[1], Version: match[2]})
+	}
+	return brands
+}
+
+// HintsFromHeaders reads the Client Hints headers through get, e.g. a
+// request's header getter
+func HintsFromHeaders(get func(key string) string) ClientHints {
+	hints := ClientHints{
+		Brands:          ParseBrandList(get("Sec-CH-UA")),
+		FullVersionList: ParseBrandList(get("Sec-CH-UA-Full-Version-List")),
+		Platform:        unquote(get("Sec-CH-UA-Platform")),
+		PlatformVersion: unquote(get("Sec-CH-UA-Platform-Version")),
+		Model:           unquote(get("Sec-CH-UA-Model")),
+	}
+
+	// structured header booleans are "?1" and "?0"
+	switch get("Sec-CH-UA-Mobile") {
+	case "?1":
+		mobile := true
+		hints.Mobile = &mobile
+	case "?0":
+		mobile := false
+		hints.Mobile = &mobile
+	}
+	return hints
+}
+
+// bounded drops what the hints carry past MaxHintBrands and versions too
+// long to be real, the rest is cut to the column widths by Result.truncate
+func (h ClientHints) bounded() ClientHints {
+	if len(h.Brands) > MaxHintBrands {
+		h.Brands = h.Brands[:MaxHintBrands]
+	}
+	if len(h.FullVersionList) > MaxHintBrands {
+		h.FullVersionList = h.FullVersionList[:MaxHintBrands]
+	}
+	if len(h.PlatformVersion) > maxVersionLength {
+		h.PlatformVersion = ""
+	}
+	h.Model = truncate(h.Model, maxModelLength)
+	return h
+}
+
+// truncate cuts s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func unquote(value string) string {
+	return strings.Trim(strings.TrimSpace(value), `"`)
+}
+
+// browser picks the real browser of the brand lists. Chromium is only
+// used when no other brand is listed, every Chromium browser includes it.
+func (h ClientHints) browser() (Brand, bool) {
+	brands := h.FullVersionList
+	if len(brands) == 0 {
+		brands = h.Brands
+	}
+
+	var chromium *Brand
+	for i, b := range brands {
+		if greaseBrand.MatchString(b.Brand) {
+			continue
+		}
+		name, ok := brandNames[b.Brand]
+		if !ok {
+			continue
+		}
+		if name == "Chromium" {
+			chromium = &brands[i]
+			continue
+		}
+		return Brand{Brand: name, Version: b.Version}, true
+	}
+
+	if chromium != nil {
+		return Brand{Brand: "Chromium", Version: chromium.Version}, true
+	}
+	return Brand{}, false
+}
+
+// osVersion turns Sec-CH-UA-Platform-Version into the version users know.
+// Windows reports its UniversalApiContract, 13 and up is Windows 11, and
+// 0.1, 0.2 and 0.3 for Windows 7, 8 and 8.1.
+func (h ClientHints) osVersion(platform string) string {
+	version := h.PlatformVersion
+	if version == "" {
+		return ""
+	}
+
+	if platform == "Windows" {
+		parts := strings.SplitN(version, ".", 3)
+		major, err := strconv.Atoi(parts[0])
+		switch {
+		case err != nil:
+			return ""
+		case major >= 13:
+			return "11"
+		case major > 0:
+			return "10"
+		}
+
+		minor := ""
+		if len(parts) > 1 {
+			minor = parts[1]
+		}
+		switch minor {
+		case "1":
+			return "7"
+		case "2":
+			return "8"
+		case "3":
+			return "8.1"
+		default:
+			return ""
+		}
+	}
+
+	// drop trailing zeros, "14.0.0" is reported as "14"
+	for strings.HasSuffix(version, ".0") {
+		version = strings.TrimSuffix(version, ".0")
+	}
+	return version
+}
@@ -0,0 +1,120 @@
+package uaparser
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+//go:embed rules.json
+var defaultRules []byte
+
+// rulesFile is the JSON format of the rule set. Rules are tried in order,
+// the first match wins, so specific rules go before generic ones.
+type rulesFile struct {
+	Version  string       `json:"version"`
+	Bots     []string     `json:"bots"`
+	Browsers []nameRule   `json:"browsers"`
+	OS       []osRule     `json:"os"`
+	Devices  []deviceRule `json:"devices"`
+}
+
+type nameRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+type osRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+
+	// maps the matched version to the marketing one, e.g. NT 6.1 is 7
+	Versions map[string]string `json:"versions,omitempty"`
+}
+
+type deviceRule struct {
+	Type    string `json:"type"`
+	Vendor  string `json:"vendor,omitempty"`
+	Pattern string `json:"pattern"`
+
+	// may reference the pattern's groups, e.g. "$1"
+	Model string `json:"model,omitempty"`
+}
+
+// Rules is a compiled rule set
+type Rules struct {
+	Version  string
+	bots     *regexp.Regexp
+	browsers []compiledRule[nameRule]
+	os       []compiledRule[osRule]
+	devices  []compiledRule[deviceRule]
+}
+
+type compiledRule[T any] struct {
+	rule T
+	re   *regexp.Regexp
+}
+
+// ParseRules compiles a JSON rule set
+func ParseRules(data []byte) (*Rules, error) {
+	var file rulesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid user agent rules: %w", err)
+	}
+
+	rules := &Rules{Version: file.Version}
+
+	if len(file.Bots) > 0 {
+		bots, err := regexp.Compile("(?i)" + strings.Join(file.Bots, "|"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bot pattern: %w", err)
+		}
+		rules.bots = bots
+	}
+
+	var err error
+	if rules.browsers, err = compileRules(file.Browsers, func(r nameRule) string { return r.Pattern }); err != nil {
+		return nil, err
+	}
+	if rules.os, err = compileRules(file.OS, func(r osRule) string { return r.Pattern }); err != nil {
+		return nil, err
+	}
+	if rules.devices, err = compileRules(file.Devices, func(r deviceRule) string { return r.Pattern }); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func compileRules[T any](rules []T, pattern func(T) string) ([]compiledRule[T], error) {
+	compiled := make([]compiledRule[T], 0, len(rules))
+	for _, rule := range rules {
+		re, err := regexp.Compile(pattern(rule))
+		if err != nil {
+			return nil, fmt.Errorf("invalid user agent pattern %q: %w", pattern(rule), err)
+		}
+		compiled = append(compiled, compiledRule[T]{rule: rule, re: re})
+	}
+	return compiled, nil
+}
+
+// LoadRules reads a rule set from a JSON file, in the format of the
+// embedded rules.json
+func LoadRules(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(data)
+}
+
+// DefaultRules returns the rule set built into the binary
+func DefaultRules() *Rules {
+	rules, err := ParseRules(defaultRules)
+	if err != nil {
+		panic(err)
+	}
+	return rules
+}
@@ -0,0 +1,216 @@
+package uaparser
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Device types
+const (
+	DeviceDesktop  = "desktop"
+	DeviceMobile   = "mobile"
+	DeviceTablet   = "tablet"
+	DeviceTV       = "tv"
+	DeviceConsole  = "console"
+	DeviceWearable = "wearable"
+	DeviceBot      = "bot"
+)
+
+const unknown = "Unknown"
+
+// Chrome's reduced UA strings replace the Android model with "K"
+const reducedModel = "K"
+
+// widths of the analytics_events columns results are stored in
+const (
+	maxNameLength    = 64
+	maxVersionLength = 64
+	maxModelLength   = 128
+)
+
+// Result is what a user agent resolved to. Fields that could not be
+// detected are "Unknown", vendor and model are left empty.
+type Result struct {
+	BrowserName    string
+	BrowserVersion string
+	OSName         string
+	OSVersion      string
+	DeviceType     string
+	DeviceVendor   string
+	DeviceModel    string
+}
+
+// Parser resolves user agents and Client Hints with a rule set, which can
+// be swapped while the parser is in use.
+type Parser struct {
+	rules atomic.Pointer[Rules]
+}
+
+func NewParser(rules *Rules) *Parser {
+	p := &Parser{}
+	p.rules.Store(rules)
+	return p
+}
+
+// SetRules replaces the rule set, lookups already running keep the old one
+func (p *Parser) SetRules(rules *Rules) {
+	p.rules.Store(rules)
+}
+
+// Rules returns the rule set in use
+func (p *Parser) Rules() *Rules {
+	return p.rules.Load()
+}
+
+// Parse resolves a user agent string. Client Hints take precedence over
+// the string, which browsers freeze to a few generic values.
+func (p *Parser) Parse(ua string, hints ClientHints) Result {
+	rules := p.rules.Load()
+	result := Result{
+		BrowserName:    unknown,
+		BrowserVersion: unknown,
+		OSName:         unknown,
+		OSVersion:      unknown,
+		DeviceType:     DeviceDesktop,
+	}
+
+	if ua == "" {
+		result.DeviceType = "unknown"
+	}
+
+	for _, r := range rules.browsers {
+		if match := r.re.FindStringSubmatch(ua); match != nil {
+			result.BrowserName = r.rule.Name
+			if len(match) > 1 && match[1] != "" {
+				result.BrowserVersion = match[1]
+			}
+			break
+		}
+	}
+
+	for _, r := range rules.os {
+		if match := r.re.FindStringSubmatch(ua); match != nil {
+			result.OSName = r.rule.Name
+			if len(match) > 1 && match[1] != "" {
+				version := strings.ReplaceAll(match[1], "_", ".")
+				if mapped, ok := r.rule.Versions[version]; ok {
+					version = mapped
+				}
+				result.OSVersion = version
+			}
+			break
+		}
+	}
+
+	if rules.bots != nil && rules.bots.MatchString(ua) {
+		result.DeviceType = DeviceBot
+	} else if ua != "" {
+		parseDevice(rules, ua, &result)
+	}
+
+	applyHints(hints.bounded(), &result)
+	result.truncate()
+	return result
+}
+
+// truncate cuts the fields taken from the user agent or the hints to the
+// width of their columns
+func (r *Result) truncate() {
+	r.BrowserName = truncate(r.BrowserName, maxNameLength)
+	r.BrowserVersion = truncate(r.BrowserVersion, maxVersionLength)
+	r.OSName = truncate(r.OSName, maxNameLength)
+	r.OSVersion = truncate(r.OSVersion, maxVersionLength)
+	r.DeviceVendor = truncate(r.DeviceVendor, maxNameLength)
+	r.DeviceModel = truncate(r.DeviceModel, maxModelLength)
+}
+
+func parseDevice(rules *Rules, ua string, result *Result) {
+	for _, r := range rules.devices {
+		match := r.re.FindStringSubmatchIndex(ua)
+		if match == nil {
+			continue
+		}
+
+		result.DeviceType = r.rule.Type
+		result.DeviceVendor = r.rule.Vendor
+		if r.rule.Model != "" {
+			model := r.re.ExpandString(nil, r.rule.Model, ua, match)
+			result.DeviceModel = strings.TrimSpace(string(model))
+		}
+		return
+	}
+
+	// Android tablets leave "Mobile" out of their user agent
+	switch {
+	case strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile"):
+		result.DeviceType = DeviceTablet
+	case strings.Contains(ua, "Mobi") || strings.Contains(ua, "Android") || strings.Contains(ua, "Opera Mini"):
+		result.DeviceType = DeviceMobile
+	}
+}
+
+func applyHints(hints ClientHints, result *Result) {
+	if brand, ok := hints.browser(); ok {
+		result.BrowserName = brand.Brand
+		if brand.Version != "" {
+			result.BrowserVersion = brand.Version
+		}
+	}
+
+	if name, ok := platformNames[hints.Platform]; ok {
+		if name != result.OSName {
+			result.OSName = name
+			result.OSVersion = unknown
+		}
+		if version := hints.osVersion(name); version != "" {
+			result.OSVersion = version
+		}
+	}
+
+	if hints.Mobile != nil && *hints.Mobile && result.DeviceType == DeviceDesktop {
+		result.DeviceType = DeviceMobile
+	}
+
+	if hints.Model != "" && hints.Model != reducedModel {
+		result.DeviceModel = hints.Model
+	}
+	if result.DeviceModel == reducedModel {
+		result.DeviceModel = ""
+	}
+}
+
+var defaultParser = NewParser(DefaultRules())
+
+// Init loads the rule set from UA_RULES_PATH when set, the embedded rules
+// are used otherwise.
+func Init() error {
+	path := os.Getenv("UA_RULES_PATH")
+	if path == "" {
+		return nil
+	}
+
+	rules, err := LoadRules(path)
+	if err != nil {
+		return err
+	}
+	defaultParser.SetRules(rules)
+	log.Println("User agent rules loaded:", path, rules.Version)
+	return nil
+}
+
+// Reload re-reads UA_RULES_PATH, on error the current rules are kept
+func Reload() error {
+	return Init()
+}
+
+// Parse resolves a user agent with the default parser
+func Parse(ua string, hints ClientHints) Result {
+	return defaultParser.Parse(ua, hints)
+}
+
+// Version returns the version of the rule set in use
+func Version() string {
+	return defaultParser.Rules().Version
+}
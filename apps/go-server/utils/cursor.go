@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+var (
+	cursorKeyOnce sync.Once
+	cursorKey     []byte
+)
+
+// cursor tokens are signed with CURSOR_SECRET. Without it a random key is
+// used, so tokens stop working when the server restarts.
+func cursorSecret() []byte {
+	cursorKeyOnce.Do(func() {
+		if secret := os.Getenv("CURSOR_SECRET"); secret != "" {
+			cursorKey = []byte(secret)
+			return
+		}
+		cursorKey = make([]byte, 32)
+		if _, err := rand.Read(cursorKey); err != nil {
+			log.Fatal("Failed to generate cursor key:", err)
+		}
+		log.Println("CURSOR_SECRET is not set, pagination cursors will not survive restarts")
+	})
+	return cursorKey
+}
+
+// SignCursor encodes v as an opaque pagination token
+func SignCursor(v any) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, cursorSecret())
+	mac.Write(payload)
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifyCursor checks the signature of a token made by SignCursor and
+// decodes it into v
+func VerifyCursor(token string, v any) error {
+	encPayload, encSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidCursor
+	}
+
+	enc := base64.RawURLEncoding
+	payload, err := enc.DecodeString(encPayload)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	sig, err := enc.DecodeString(encSig)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, cursorSecret())
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(payload, v); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"supametrics/db"
+	"supametrics/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	deadLetterStream = "deadletter:events"
+
+	// entries past the max attempts move here, out of the retry worker's way
+	parkedLetterStream = "deadletter:parked"
+
+	// held by the instance replaying dead letters
+	deadLetterLeaseKey = "deadletter:lease"
+
+	// oldest entries are trimmed past this, so an outage can't fill Redis
+	deadLetterMaxLen = 100_000
+
+	// entries failing this many retries are parked for operators
+	DeadLetterMaxAttempts = 10
+)
+
+// DeadLetter is a failed event write waiting to be retried
+type DeadLetter struct {
+	ID       string                `json:"id"`
+	Parked   bool                  `json:"parked"`
+	Attempts int                   `json:"attempts"`
+	Error    string                `json:"error"`
+	FailedAt time.Time             `json:"failed_at"`
+	Event    models.AnalyticsEvent `json:"event"`
+}
+
+// PushDeadLetter stores an event whose first insert failed and counts the
+// failure
+func PushDeadLetter(event models.AnalyticsEvent, cause error) error {
+	IncrementMetric("events_failed")
+
+	args, err := deadLetterArgs(event, cause.Error(), 0)
+	if err != nil {
+		return err
+	}
+	return db.Redis.XAdd(db.Ctx, args).Err()
+}
+
+// RequeueDeadLetter replaces a dead letter by one with the given attempt
+// count in a single MULTI, so a crash can't drop or duplicate it. Letters
+// past DeadLetterMaxAttempts go to the parked stream. Retries are counted
+// as events_retried.
+func RequeueDeadLetter(letter DeadLetter, cause string, attempts int) error {
+	if attempts > letter.Attempts {
+		IncrementMetric("events_retried")
+	}
+
+	args, err := deadLetterArgs(letter.Event, cause, attempts)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Redis.TxPipelined(db.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(db.Ctx, args)
+		pipe.XDel(db.Ctx, letter.stream(), letter.ID)
+		return nil
+	})
+	return err
+}
+
+func deadLetterArgs(event models.AnalyticsEvent, cause string, attempts int) (*redis.XAddArgs, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := deadLetterStream
+	if attempts >= DeadLetterMaxAttempts {
+		stream = parkedLetterStream
+	}
+
+	return &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: deadLetterMaxLen,
+		Approx: true,
+		Values: map[string]any{
+			"event":     payload,
+			"error":     cause,
+			"attempts":  attempts,
+			"failed_at": time.Now().UTC().Format(time.RFC3339),
+		},
+	}, nil
+}
+
+// AcquireDeadLetterLease makes this instance the only one replaying dead
+// letters for ttl. ok is false when another instance holds the lease,
+// release gives it up early.
+func AcquireDeadLetterLease(ttl time.Duration) (release func(), ok bool) {
+	token := uuid.NewString()
+	ok, err := db.Redis.SetNX(db.Ctx, deadLetterLeaseKey, token, ttl).Result()
+	if err != nil || !ok {
+		return func() {}, false
+	}
+
+	return func() {
+		// only delete the lease while it is still ours
+		_ = releaseLease.Run(db.Ctx, db.Redis, []string{deadLetterLeaseKey}, token).Err()
+	}, true
+}
+
+var releaseLease = redis.NewScript(`
+	if redis.call("GET", KEYS[1]) == ARGV[1] then
+		return redis.call("DEL", KEYS[1])
+	end
+	return 0
+`)
+
+// ListDeadLetters returns the oldest dead letters waiting to be retried, up to count
+func ListDeadLetters(count int64) ([]DeadLetter, error) {
+	return listLetters(deadLetterStream, count)
+}
+
+// ListParkedLetters returns the oldest parked dead letters, up to count
+func ListParkedLetters(count int64) ([]DeadLetter, error) {
+	return listLetters(parkedLetterStream, count)
+}
+
+func listLetters(stream string, count int64) ([]DeadLetter, error) {
+	messages, err := db.Redis.XRangeN(db.Ctx, stream, "-", "+", count).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, 0, len(messages))
+	for _, msg := range messages {
+		letter := DeadLetter{ID: msg.ID, Parked: stream == parkedLetterStream}
+
+		if raw, ok := msg.Values["event"].(string); ok {
+			_ = json.Unmarshal([]byte(raw), &letter.Event)
+		}
+		if cause, ok := msg.Values["error"].(string); ok {
+			letter.Error = cause
+		}
+		if raw, ok := msg.Values["attempts"].(string); ok {
+			letter.Attempts, _ = strconv.Atoi(raw)
+		}
+		if raw, ok := msg.Values["failed_at"].(string); ok {
+			letter.FailedAt, _ = time.Parse(time.RFC3339, raw)
+		}
+
+		letters = append(letters, letter)
+	}
+	return letters, nil
+}
+
+// DeleteDeadLetter removes a dead letter once it was written
+func DeleteDeadLetter(letter DeadLetter) error {
+	return db.Redis.XDel(db.Ctx, letter.stream(), letter.ID).Err()
+}
+
+func (l DeadLetter) stream() string {
+	if l.Parked {
+		return parkedLetterStream
+	}
+	return deadLetterStream
+}
+
+// CountDeadLetters returns how many events are waiting in the dead-letter stream
+func CountDeadLetters() (int64, error) {
+	return db.Redis.XLen(db.Ctx, deadLetterStream).Result()
+}
+
+// CountParkedLetters returns how many events are parked for operators
+func CountParkedLetters() (int64, error) {
+	return db.Redis.XLen(db.Ctx, parkedLetterStream).Result()
+}
+
+// IncrementMetric bumps an operational counter, failures are ignored
+func IncrementMetric(name string) {
+	_ = db.Redis.Incr(db.Ctx, "metrics:"+name).Err()
+}
+
+// GetMetric reads an operational counter, missing counters are 0
+func GetMetric(name string) int64 {
+	count, err := db.Redis.Get(db.Ctx, "metrics:"+name).Int64()
+	if err != nil {
+		return 0
+	}
+	return count
+}
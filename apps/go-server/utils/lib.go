@@ -16,3 +16,21 @@ func GetQuota(plan string) int {
 		return FreeQuota
 	}
 }
+
+const (
+	FreeDailyLinks      = 30
+	PaidDailyLinks      = 200
+	UnlimitedDailyLinks = 0
+)
+
+// GetDailyLinkQuota returns how many short links a plan can create per day
+func GetDailyLinkQuota(plan string) int {
+	switch plan {
+	case "paid":
+		return PaidDailyLinks
+	case "enterprise":
+		return UnlimitedDailyLinks
+	default:
+		return FreeDailyLinks
+	}
+}
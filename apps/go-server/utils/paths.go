@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	uuidSegment = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	idSegment   = regexp.MustCompile(`^[0-9]+$`)
+	hashSegment = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// TemplatePath replaces the dynamic segments of a pathname with
+// placeholders, e.g. /orders/123 is /orders/:id. It matches PathTemplateSQL.
+func TemplatePath(pathname string) string {
+	segments := strings.Split(pathname, "/")
+	for i, segment := range segments {
+		switch {
+		case uuidSegment.MatchString(segment):
+			segments[i] = ":uuid"
+		case idSegment.MatchString(segment):
+			segments[i] = ":id"
+		case hashSegment.MatchString(segment):
+			segments[i] = ":hash"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// PathTemplateSQL is the SQL expression of TemplatePath for a column
+func PathTemplateSQL(column string) string {
+	expr := column
+	for _, r := range []struct{ pattern, placeholder string }{
+		{`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`, ":uuid"},
+		{`[0-9]+`, ":id"},
+		{`[0-9a-fA-F]{16,}`, ":hash"},
+	} {
+		expr = fmt.Sprintf(`regexp_replace(%s, '/%s(?=/|$)', '/%s', 'g')`, expr, r.pattern, r.placeholder)
+	}
+	return expr
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"database/sql"
+	"time"
+
+	"supametrics/db"
+	"supametrics/models"
+
+	"github.com/lib/pq"
+)
+
+const projectSettingsTTL = 5 * time.Minute
+
+// GetProjectSettings loads the settings of a project, cached in Redis.
+// Falls back to the defaults when the project has no settings row.
+func GetProjectSettings(projectID string) (models.ProjectSettings, error) {
+	settings := models.DefaultProjectSettings(projectID)
+	if err := GetCache("project_settings", projectID, &settings); err == nil {
+		return settings, nil
+	}
+
+	query := `
+		SELECT hash_routing, track_outbound, excluded_paths, geo_precision, locale,
+			timezone, week_start, visitor_strategy
+		FROM project_settings
+		WHERE project_id = $1
+		LIMIT 1;
+	`
+
+	var excludedPaths []string
+	err := db.DB.QueryRow(query, projectID).Scan(
+		&settings.HashRouting,
+		&settings.TrackOutbound,
+		pq.Array(&excludedPaths),
+		&settings.GeoPrecision,
+		&settings.Locale,
+		&settings.Timezone,
+		&settings.WeekStart,
+		&settings.VisitorStrategy,
+	)
+	if err != nil && err != sql.ErrNoRows {
+		return models.DefaultProjectSettings(projectID), err
+	}
+	if excludedPaths != nil {
+		settings.ExcludedPaths = excludedPaths
+	}
+
+	_ = SetCache("project_settings", projectID, settings, projectSettingsTTL)
+	return settings, nil
+}
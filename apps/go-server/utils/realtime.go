@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"supametrics/db"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// visitors count as active this long after their last event
+const RealtimeWindow = 5 * time.Minute
+
+// ActiveVisitor is where a visitor was at their last event
+type ActiveVisitor struct {
+	VisitorID string    `json:"visitorId"`
+	Pathname  string    `json:"pathname"`
+	Country   *string   `json:"country"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+func realtimeKeys(projectID string) (visitors, pages string) {
+	return "realtime:" + projectID + ":visitors", "realtime:" + projectID + ":pages"
+}
+
+func liveChannel(projectID string) string {
+	return "live:" + projectID
+}
+
+// TrackActiveVisitor scores the visitor by the time of their last event in
+// a sorted set and keeps their current page next to it. Both keys expire
+// once the project has been quiet for a while.
+func TrackActiveVisitor(projectID string, visitor ActiveVisitor) error {
+	visitorsKey, pagesKey := realtimeKeys(projectID)
+
+	payload, err := json.Marshal(visitor)
+	if err != nil {
+		return err
+	}
+
+	pipe := db.Redis.TxPipeline()
+	pipe.ZAdd(db.Ctx, visitorsKey, redis.Z{Score: float64(visitor.LastSeen.Unix()), Member: visitor.VisitorID})
+	pipe.HSet(db.Ctx, pagesKey, visitor.VisitorID, payload)
+	pipe.Expire(db.Ctx, visitorsKey, 2*RealtimeWindow)
+	pipe.Expire(db.Ctx, pagesKey, 2*RealtimeWindow)
+	_, err = pipe.Exec(db.Ctx)
+	return err
+}
+
+// ActiveVisitors returns the visitors seen within RealtimeWindow of now,
+// most recent first, and drops the ones that went quiet
+func ActiveVisitors(projectID string, now time.Time) ([]ActiveVisitor, error) {
+	visitorsKey, pagesKey := realtimeKeys(projectID)
+	cutoff := strconv.FormatInt(now.Add(-RealtimeWindow).Unix(), 10)
+
+	stale, err := db.Redis.ZRangeByScore(db.Ctx, visitorsKey, &redis.ZRangeBy{Min: "-inf", Max: "(" + cutoff}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(stale) > 0 {
+		pipe := db.Redis.TxPipeline()
+		pipe.ZRemRangeByScore(db.Ctx, visitorsKey, "-inf", "("+cutoff)
+		pipe.HDel(db.Ctx, pagesKey, stale...)
+		if _, err := pipe.Exec(db.Ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	ids, err := db.Redis.ZRevRangeByScore(db.Ctx, visitorsKey, &redis.ZRangeBy{Min: cutoff, Max: "+inf"}).Result()
+	if err != nil || len(ids) == 0 {
+		return []ActiveVisitor{}, err
+	}
+
+	values, err := db.Redis.HMGet(db.Ctx, pagesKey, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	visitors := make([]ActiveVisitor, 0, len(values))
+	for _, value := range values {
+		raw, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var visitor ActiveVisitor
+		if err := json.Unmarshal([]byte(raw), &visitor); err != nil {
+			continue
+		}
+		visitors = append(visitors, visitor)
+	}
+	return visitors, nil
+}
+
+// PublishLiveEvent sends an ingested event to the dashboards streaming the
+// project. Nothing is kept when no one is listening.
+func PublishLiveEvent(projectID string, payload []byte) error {
+	return db.Redis.Publish(db.Ctx, liveChannel(projectID), payload).Err()
+}
+
+// SubscribeLiveEvents listens for the events published for the project,
+// the caller closes the subscription
+func SubscribeLiveEvents(ctx context.Context, projectID string) *redis.PubSub {
+	return db.Redis.Subscribe(ctx, liveChannel(projectID))
+}
@@ -75,3 +75,9 @@ func IncrementCache(namespace, key string, ttl time.Duration) (int, error) {
 	db.Redis.Expire(db.Ctx, fullKey, ttl)
 	return int(count), nil
 }
+
+// DecrementCache takes back an IncrementCache, e.g. when the counted
+// action failed
+func DecrementCache(namespace, key string) error {
+	return db.Redis.Decr(db.Ctx, namespace+":"+key).Err()
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// larger values are not real screens, they come from spoofed payloads
+const maxScreenPixels = 16384
+
+// Breakpoint is a screen size bucket, for widths from MinWidth up to the
+// next breakpoint
+type Breakpoint struct {
+	Name     string
+	MinWidth int
+}
+
+// ScreenBreakpoints are the common CSS breakpoints, smallest first
+var ScreenBreakpoints = []Breakpoint{
+	{"xs", 0},
+	{"sm", 576},
+	{"md", 768},
+	{"lg", 992},
+	{"xl", 1200},
+	{"xxl", 1400},
+}
+
+// ValidScreenDimension drops missing and implausible widths or heights
+func ValidScreenDimension(pixels *int) *int {
+	if pixels == nil || *pixels <= 0 || *pixels > maxScreenPixels {
+		return nil
+	}
+	return pixels
+}
+
+// ScreenSize returns the breakpoint a width falls into
+func ScreenSize(width *int) *string {
+	if width == nil {
+		return nil
+	}
+
+	size := ScreenBreakpoints[0].Name
+	for _, b := range ScreenBreakpoints {
+		if *width >= b.MinWidth {
+			size = b.Name
+		}
+	}
+	return &size
+}
+
+// ScreenSizeSQL buckets a width column into ScreenBreakpoints in SQL
+func ScreenSizeSQL(column string) string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	for i := len(ScreenBreakpoints) - 1; i > 0; i-- {
+		fmt.Fprintf(&b, " WHEN %s >= %d THEN '%s'", column, ScreenBreakpoints[i].MinWidth, ScreenBreakpoints[i].Name)
+	}
+	fmt.Fprintf(&b, " WHEN %s IS NOT NULL THEN '%s' END", column, ScreenBreakpoints[0].Name)
+	return b.String()
+}
+
+// maxLanguageLength is the width of the language column
+const maxLanguageLength = 35
+
+// NormalizeLanguage canonicalizes a BCP 47 tag, e.g. "en_us" is "en-US".
+// Invalid tags and ones longer than maxLanguageLength are dropped.
+func NormalizeLanguage(tag string) *string {
+	tag = strings.TrimSpace(tag)
+	if len(tag) > maxLanguageLength {
+		return nil
+	}
+
+	parsed, err := language.Parse(tag)
+	if err != nil || parsed == language.Und {
+		return nil
+	}
+
+	normalized := parsed.String()
+	if len(normalized) > maxLanguageLength {
+		return nil
+	}
+	return &normalized
+}
+
+// PreferredLanguage returns the first language of an Accept-Language header
+func PreferredLanguage(header string) *string {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil {
+		return nil
+	}
+
+	for _, tag := range tags {
+		// "*" parses as "mul", any language
+		if tag.String() != "mul" {
+			return NormalizeLanguage(tag.String())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"supametrics/db"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// a visitor's session ends after this long without events
+const SessionTimeout = 30 * time.Minute
+
+// AssignSession returns the current session of a visitor, starting a new
+// one when the last event is older than SessionTimeout. Every event gets
+// its own session when Redis is unavailable.
+func AssignSession(projectID, visitorID string) string {
+	key := "session:" + projectID + ":" + visitorID
+	sessionID := uuid.New().String()
+
+	created, err := db.Redis.SetNX(db.Ctx, key, sessionID, SessionTimeout).Result()
+	if err != nil || created {
+		return sessionID
+	}
+
+	// an ongoing session, each event pushes its expiry back
+	current, err := db.Redis.GetEx(db.Ctx, key, SessionTimeout).Result()
+	if err != nil {
+		return sessionID
+	}
+	return current
+}
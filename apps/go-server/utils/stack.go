@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+const maxStackFrames = 10
+
+var (
+	// matches ":12:34" or ":12" at the end of a frame location
+	lineColRegex = regexp.MustCompile(`:\d+(:\d+)?\)?$`)
+
+	// matches scheme + host so the same bundle groups across domains
+	originRegex = regexp.MustCompile(`[a-z][a-z0-9+.-]*://[^/\s)]+`)
+
+	// matches query strings and hashes in frame urls
+	queryRegex = regexp.MustCompile(`[?#][^\s):]*`)
+
+	// matches build hashes in bundle names, e.g. main.3f2a1b9c.js
+	bundleHashRegex = regexp.MustCompile(`[.-][0-9a-f]{8,}\.`)
+
+	// matches volatile parts of error messages
+	quotedRegex = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+	numberRegex = regexp.MustCompile(`\b0x[0-9a-f]+\b|\b\d+\b`)
+	spaceRegex  = regexp.MustCompile(`\s+`)
+)
+
+// NormalizeStack strips line/column numbers, origins, query strings and
+// build hashes from a JS stack trace so that the same error thrown from
+// different deploys or hosts produces the same frames.
+// Supports both V8 ("at fn (url:1:2)") and Firefox/Safari ("fn@url:1:2") formats.
+func NormalizeStack(stack string) []string {
+	var frames []string
+
+	for _, line := range strings.Split(stack, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		isV8Frame := strings.HasPrefix(line, "at ")
+		if !isV8Frame && !strings.Contains(line, "@") {
+			// message line, e.g. "TypeError: x is undefined"
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "at ")
+		line = lineColRegex.ReplaceAllString(line, "")
+		line = originRegex.ReplaceAllString(line, "")
+		line = queryRegex.ReplaceAllString(line, "")
+		line = bundleHashRegex.ReplaceAllString(line, ".")
+		line = strings.TrimSuffix(strings.TrimPrefix(line, "("), ")")
+		line = strings.ReplaceAll(line, "(", "")
+		line = spaceRegex.ReplaceAllString(strings.TrimSpace(line), " ")
+
+		frames = append(frames, line)
+		if len(frames) == maxStackFrames {
+			break
+		}
+	}
+
+	return frames
+}
+
+// NormalizeErrorMessage replaces quoted values and numbers in an error
+// message, e.g. `Cannot read "id" of item 42` -> `Cannot read "?" of item ?`.
+func NormalizeErrorMessage(message string) string {
+	message = quotedRegex.ReplaceAllString(message, `"?"`)
+	message = numberRegex.ReplaceAllString(message, "?")
+	return spaceRegex.ReplaceAllString(strings.TrimSpace(message), " ")
+}
+
+// ErrorFingerprint groups error events into issues.
+// When a stack is present the frames decide the group, otherwise the
+// normalized message and source file are used.
+func ErrorFingerprint(message, stack, source string) string {
+	base := NormalizeErrorMessage(message)
+
+	if frames := NormalizeStack(stack); len(frames) > 0 {
+		base += "\n" + strings.Join(frames, "\n")
+	} else if source != "" {
+		source = originRegex.ReplaceAllString(source, "")
+		source = queryRegex.ReplaceAllString(source, "")
+		base += "\n" + bundleHashRegex.ReplaceAllString(source, ".")
+	}
+
+	hash := sha256.Sum256([]byte(base))
+	return hex.EncodeToString(hash[:])[:32]
+}
@@ -23,10 +23,20 @@ func GetRealClientIP(c *fiber.Ctx) string {
 	return c.IP()
 }
 
-// GenerateAnonVisitorID creates a privacy-friendly, daily-reset visitor hash.
+const maxUserIDLength = 128
+
+// how long a visitor hash stays the same, see project_settings.visitor_strategy
+var visitorPeriods = map[string]string{
+	"daily":      "2006-01-02",
+	"monthly":    "2006-01",
+	"persistent": "",
+}
+
+// GenerateAnonVisitorID creates a privacy-friendly visitor hash, reset
+// daily unless the project picked a longer lived strategy.
 // It uses IP (truncated), User-Agent, and current date.
 // This is similar to how Plausible/Simple Analytics work.
-func GenerateAnonVisitorID(ip, userAgent string, t time.Time) string {
+func GenerateAnonVisitorID(ip, userAgent string, t time.Time, strategy string) string {
 	// Anonymize IP: remove last octet for IPv4, shorten IPv6
 	if ip == "" {
 		ip = "unknown"
@@ -48,8 +58,12 @@ func GenerateAnonVisitorID(ip, userAgent string, t time.Time) string {
 		userAgent = "unknown"
 	}
 
-	// Only date matters (rotates daily)
-	date := t.Format("2006-01-02")
+	// Only date matters (rotates daily by default)
+	layout, ok := visitorPeriods[strategy]
+	if !ok {
+		layout = visitorPeriods["daily"]
+	}
+	date := t.Format(layout)
 
 	// Build fingerprint base
 	base := fmt.Sprintf("%s|%s|%s", ip, userAgent, date)
@@ -58,6 +72,19 @@ func GenerateAnonVisitorID(ip, userAgent string, t time.Time) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// NormalizeUserID trims an identified user id, nil when it is empty or
+// too long to store
+func NormalizeUserID(id *string) *string {
+	if id == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*id)
+	if trimmed == "" || len(trimmed) > maxUserIDLength {
+		return nil
+	}
+	return &trimmed
+}
+
 // GetUserHash generates a stable hash for IP+UA (used for rate limiting, not analytics).
 func GetUserHash(ip, userAgent string) string {
 	if ip == "" {
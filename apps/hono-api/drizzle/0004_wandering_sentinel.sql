@@ -0,0 +1,28 @@
+CREATE TABLE "issues" (
+	"id" serial PRIMARY KEY NOT NULL,
+	"uuid" uuid DEFAULT gen_random_uuid() NOT NULL,
+	"project_id" uuid NOT NULL,
+	"fingerprint" varchar(64) NOT NULL,
+	"message" text NOT NULL,
+	"stack" text,
+	"source_file" text,
+	"line_number" integer,
+	"column_number" integer,
+	"release" varchar(128),
+	"first_seen" timestamp DEFAULT now() NOT NULL,
+	"last_seen" timestamp DEFAULT now() NOT NULL,
+	"occurrences" integer DEFAULT 0 NOT NULL,
+	"affected_visitors" integer DEFAULT 0 NOT NULL,
+	CONSTRAINT "issues_uuid_unique" UNIQUE("uuid"),
+	CONSTRAINT "issues_project_id_fingerprint_unique" UNIQUE("project_id","fingerprint")
+);
+--> statement-breakpoint
+CREATE TABLE "issue_visitors" (
+	"id" serial PRIMARY KEY NOT NULL,
+	"issue_id" uuid NOT NULL,
+	"visitor_id" varchar(64) NOT NULL,
+	CONSTRAINT "issue_visitors_issue_id_visitor_id_unique" UNIQUE("issue_id","visitor_id")
+);
+--> statement-breakpoint
+ALTER TABLE "issues" ADD CONSTRAINT "issues_project_id_projects_uuid_fk" FOREIGN KEY ("project_id") REFERENCES "public"."projects"("uuid") ON DELETE cascade ON UPDATE no action;--> statement-breakpoint
+ALTER TABLE "issue_visitors" ADD CONSTRAINT "issue_visitors_issue_id_issues_uuid_fk" FOREIGN KEY ("issue_id") REFERENCES "public"."issues"("uuid") ON DELETE cascade ON UPDATE no action;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE "project_settings" (
+	"id" serial PRIMARY KEY NOT NULL,
+	"project_id" uuid NOT NULL,
+	"hash_routing" boolean DEFAULT false NOT NULL,
+	"track_outbound" boolean DEFAULT false NOT NULL,
+	"excluded_paths" text[] DEFAULT '{}' NOT NULL,
+	"created_at" timestamp DEFAULT now(),
+	"updated_at" timestamp DEFAULT now(),
+	CONSTRAINT "project_settings_project_id_unique" UNIQUE("project_id")
+);
+--> statement-breakpoint
+ALTER TABLE "project_settings" ADD CONSTRAINT "project_settings_project_id_projects_uuid_fk" FOREIGN KEY ("project_id") REFERENCES "public"."projects"("uuid") ON DELETE cascade ON UPDATE no action;
\ No newline at end of file
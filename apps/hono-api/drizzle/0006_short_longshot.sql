@@ -0,0 +1,15 @@
+CREATE TABLE "short_links" (
+	"id" serial PRIMARY KEY NOT NULL,
+	"uuid" uuid DEFAULT gen_random_uuid() NOT NULL,
+	"project_id" uuid NOT NULL,
+	"slug" varchar(64) NOT NULL,
+	"destination_url" text NOT NULL,
+	"disabled" boolean DEFAULT false NOT NULL,
+	"expires_at" timestamp,
+	"created_at" timestamp DEFAULT now() NOT NULL,
+	"updated_at" timestamp DEFAULT now() NOT NULL,
+	CONSTRAINT "short_links_uuid_unique" UNIQUE("uuid"),
+	CONSTRAINT "short_links_slug_unique" UNIQUE("slug")
+);
+--> statement-breakpoint
+ALTER TABLE "short_links" ADD CONSTRAINT "short_links_project_id_projects_uuid_fk" FOREIGN KEY ("project_id") REFERENCES "public"."projects"("uuid") ON DELETE cascade ON UPDATE no action;
\ No newline at end of file
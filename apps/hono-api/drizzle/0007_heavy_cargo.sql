@@ -0,0 +1,21 @@
+CREATE TABLE "import_jobs" (
+	"id" serial PRIMARY KEY NOT NULL,
+	"uuid" uuid DEFAULT gen_random_uuid() NOT NULL,
+	"project_id" uuid NOT NULL,
+	"format" varchar(32) NOT NULL,
+	"filename" text NOT NULL,
+	"status" varchar(32) DEFAULT 'pending' NOT NULL,
+	"enrich" boolean DEFAULT false NOT NULL,
+	"processed_rows" integer DEFAULT 0 NOT NULL,
+	"imported_rows" integer DEFAULT 0 NOT NULL,
+	"failed_rows" integer DEFAULT 0 NOT NULL,
+	"errors" jsonb DEFAULT '[]'::jsonb NOT NULL,
+	"created_at" timestamp DEFAULT now() NOT NULL,
+	"started_at" timestamp,
+	"updated_at" timestamp DEFAULT now() NOT NULL,
+	"finished_at" timestamp,
+	CONSTRAINT "import_jobs_uuid_unique" UNIQUE("uuid")
+);
+--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "import_id" uuid;--> statement-breakpoint
+ALTER TABLE "import_jobs" ADD CONSTRAINT "import_jobs_project_id_projects_uuid_fk" FOREIGN KEY ("project_id") REFERENCES "public"."projects"("uuid") ON DELETE cascade ON UPDATE no action;
\ No newline at end of file
@@ -0,0 +1,16 @@
+CREATE TABLE "imported_stats" (
+	"id" serial PRIMARY KEY NOT NULL,
+	"import_id" uuid NOT NULL,
+	"project_id" uuid NOT NULL,
+	"date" date NOT NULL,
+	"dimension" varchar(32) NOT NULL,
+	"value" text DEFAULT '' NOT NULL,
+	"visitors" integer DEFAULT 0 NOT NULL,
+	"pageviews" integer DEFAULT 0 NOT NULL,
+	"visits" integer DEFAULT 0 NOT NULL,
+	"bounces" integer DEFAULT 0 NOT NULL,
+	"visit_duration" integer DEFAULT 0 NOT NULL
+);
+--> statement-breakpoint
+ALTER TABLE "imported_stats" ADD CONSTRAINT "imported_stats_import_id_import_jobs_uuid_fk" FOREIGN KEY ("import_id") REFERENCES "public"."import_jobs"("uuid") ON DELETE cascade ON UPDATE no action;--> statement-breakpoint
+ALTER TABLE "imported_stats" ADD CONSTRAINT "imported_stats_project_id_projects_uuid_fk" FOREIGN KEY ("project_id") REFERENCES "public"."projects"("uuid") ON DELETE cascade ON UPDATE no action;
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE "analytics_events" ADD COLUMN "region" varchar(128);--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "latitude" double precision;--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "longitude" double precision;--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "timezone" varchar(64);--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "isp" varchar(256);
\ No newline at end of file
@@ -0,0 +1,8 @@
+ALTER TABLE "project_settings" ADD COLUMN "geo_precision" varchar(16) DEFAULT 'city' NOT NULL;--> statement-breakpoint
+ALTER TABLE "project_settings" ADD COLUMN "locale" varchar(16) DEFAULT 'en' NOT NULL;--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "country_name" varchar(128);--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "continent" varchar(2);--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "postal_code" varchar(16);--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "asn" integer;--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "as_organization" varchar(256);--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "datacenter" boolean DEFAULT false NOT NULL;
\ No newline at end of file
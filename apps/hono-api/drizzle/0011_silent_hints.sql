@@ -0,0 +1,2 @@
+ALTER TABLE "analytics_events" ADD COLUMN "device_vendor" varchar(64);--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "device_model" varchar(128);
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE "analytics_events" ADD COLUMN "screen_width" integer;--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "screen_height" integer;--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "screen_size" varchar(8);--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "viewport_width" integer;--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "language" varchar(35);
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE "project_settings" ADD COLUMN "timezone" varchar(64) DEFAULT 'UTC' NOT NULL;--> statement-breakpoint
+ALTER TABLE "project_settings" ADD COLUMN "week_start" varchar(8) DEFAULT 'monday' NOT NULL;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE "project_settings" ADD COLUMN "visitor_strategy" varchar(16) DEFAULT 'daily' NOT NULL;--> statement-breakpoint
+ALTER TABLE "analytics_events" ADD COLUMN "user_id" varchar(128);
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE "goals" (
+	"id" serial PRIMARY KEY NOT NULL,
+	"uuid" uuid DEFAULT gen_random_uuid() NOT NULL,
+	"project_id" uuid NOT NULL,
+	"name" varchar(100) NOT NULL,
+	"type" varchar(16) NOT NULL,
+	"pathname" text,
+	"event_name" varchar(128),
+	"filters" text DEFAULT '' NOT NULL,
+	"revenue_property" varchar(128),
+	"created_at" timestamp DEFAULT now() NOT NULL,
+	"updated_at" timestamp DEFAULT now() NOT NULL,
+	CONSTRAINT "goals_uuid_unique" UNIQUE("uuid"),
+	CONSTRAINT "goals_project_id_name_unique" UNIQUE("project_id","name")
+);
+--> statement-breakpoint
+ALTER TABLE "goals" ADD CONSTRAINT "goals_project_id_projects_uuid_fk" FOREIGN KEY ("project_id") REFERENCES "public"."projects"("uuid") ON DELETE cascade ON UPDATE no action;
\ No newline at end of file
@@ -0,0 +1,2 @@
+CREATE INDEX "analytics_events_import_id_idx" ON "analytics_events" USING btree ("import_id") WHERE "analytics_events"."import_id" IS NOT NULL;--> statement-breakpoint
+CREATE INDEX "analytics_events_project_id_timestamp_idx" ON "analytics_events" USING btree ("project_id","timestamp");
\ No newline at end of file
@@ -10,7 +10,11 @@ import {
   jsonb,
   pgEnum,
   unique,
+  date,
+  doublePrecision,
+  index,
 } from "drizzle-orm/pg-core";
+import { sql } from "drizzle-orm";
 import { user } from "./auth-schema.js"; // NB: remove the .js when runing npx drizzle-kit generate
 
 // Enums
@@ -118,8 +122,36 @@ export const projectApiKeys = pgTable("project_api_keys", {
   revokedAt: timestamp("revoked_at"),
 });
 
-// analytics Events
-export const analyticsEvents = pgTable("analytics_events", {
+// project Settings (read by the go server, one row per project)
+export const projectSettings = pgTable("project_settings", {
+  id: serial("id").primaryKey(),
+  projectId: uuid("project_id")
+    .notNull()
+    .unique()
+    .references(() => projects.uuid, { onDelete: "cascade" }),
+
+  // tracker script
+  hashRouting: boolean("hash_routing").default(false).notNull(),
+  trackOutbound: boolean("track_outbound").default(false).notNull(),
+  excludedPaths: text("excluded_paths").array().default([]).notNull(), // glob patterns, e.g. /admin/**
+
+  // geo enrichment
+  geoPrecision: varchar("geo_precision", { length: 16 }).default("city").notNull(), // "city", "region" or "country"
+  locale: varchar("locale", { length: 16 }).default("en").notNull(), // language of stored country names
+
+  // reporting
+  timezone: varchar("timezone", { length: 64 }).default("UTC").notNull(), // IANA name, e.g. "Africa/Lagos"
+  weekStart: varchar("week_start", { length: 8 }).default("monday").notNull(), // "monday" or "sunday"
+
+  // visitor identity
+  visitorStrategy: varchar("visitor_strategy", { length: 16 }).default("daily").notNull(), // "daily", "monthly" or "persistent" visitor hashes
+
+  createdAt: timestamp("created_at").defaultNow(),
+  updatedAt: timestamp("updated_at").defaultNow(),
+});
+
+// Import Jobs (bulk historical imports, run by the go server)
+export const importJobs = pgTable("import_jobs", {
   id: serial("id").primaryKey(),
   uuid: uuid("uuid").defaultRandom().notNull().unique(),
 
@@ -127,38 +159,208 @@ export const analyticsEvents = pgTable("analytics_events", {
     .notNull()
     .references(() => projects.uuid, { onDelete: "cascade" }),
 
-  sessionId: varchar("session_id", { length: 64 }).notNull(), // unique per session
-  visitorId: varchar("visitor_id", { length: 64 }), // anonymous visitor ID (daily)
+  format: varchar("format", { length: 32 }).notNull(), // e.g. "csv", "ndjson"
+  filename: text("filename").notNull(),
+  status: varchar("status", { length: 32 }).notNull().default("pending"), // pending, running, completed, failed, rolled_back
+  enrich: boolean("enrich").default(false).notNull(),
 
-  timestamp: timestamp("timestamp").defaultNow(),
+  processedRows: integer("processed_rows").default(0).notNull(),
+  importedRows: integer("imported_rows").default(0).notNull(),
+  failedRows: integer("failed_rows").default(0).notNull(),
+  errors: jsonb("errors").default([]).notNull(), // first failed rows
 
-  pathname: text("pathname").notNull(),
-  referrer: text("referrer"),
-  hostname: text("hostname"),
+  createdAt: timestamp("created_at").defaultNow().notNull(),
+  startedAt: timestamp("started_at"),
+  updatedAt: timestamp("updated_at").defaultNow().notNull(),
+  finishedAt: timestamp("finished_at"),
+});
 
-  utmSource: varchar("utm_source", { length: 64 }),
-  utmMedium: varchar("utm_medium", { length: 64 }),
-  utmCampaign: varchar("utm_campaign", { length: 64 }),
-  utmTerm: varchar("utm_term", { length: 64 }),
-  utmContent: varchar("utm_content", { length: 64 }),
+// Imported Stats (daily aggregates from plausible / GA4 exports)
+export const importedStats = pgTable("imported_stats", {
+  id: serial("id").primaryKey(),
+  importId: uuid("import_id")
+    .notNull()
+    .references(() => importJobs.uuid, { onDelete: "cascade" }),
+  projectId: uuid("project_id")
+    .notNull()
+    .references(() => projects.uuid, { onDelete: "cascade" }),
 
-  eventType: varchar("event_type", { length: 64 }).notNull(), // e.g. "pageview"
-  eventName: varchar("event_name", { length: 128 }), // e.g. "cta_clicked"
-  eventData: jsonb("event_data"),
+  date: date("date").notNull(),
+  dimension: varchar("dimension", { length: 32 }).notNull(), // total, page, source, country, device
+  value: text("value").notNull().default(""), // empty for totals
 
-  country: varchar("country", { length: 64 }),
-  city: varchar("city", { length: 128 }),
+  visitors: integer("visitors").default(0).notNull(),
+  pageviews: integer("pageviews").default(0).notNull(),
+  visits: integer("visits").default(0).notNull(),
+  bounces: integer("bounces").default(0).notNull(),
+  visitDuration: integer("visit_duration").default(0).notNull(), // summed seconds
+});
+
+// analytics Events
+export const analyticsEvents = pgTable(
+  "analytics_events",
+  {
+    id: serial("id").primaryKey(),
+    uuid: uuid("uuid").defaultRandom().notNull().unique(),
+
+    projectId: uuid("project_id")
+      .notNull()
+      .references(() => projects.uuid, { onDelete: "cascade" }),
+
+    sessionId: varchar("session_id", { length: 64 }).notNull(), // unique per session
+    visitorId: varchar("visitor_id", { length: 64 }), // anonymous visitor ID, see project_settings.visitor_strategy
+    userId: varchar("user_id", { length: 128 }), // identified user, set with supametrics.identify
+
+    timestamp: timestamp("timestamp").defaultNow(),
+
+    pathname: text("pathname").notNull(),
+    referrer: text("referrer"),
+    hostname: text("hostname"),
 
-  browserName: varchar("browser_name", { length: 64 }),
-  browserVersion: varchar("browser_version", { length: 64 }),
-  osName: varchar("os_name", { length: 64 }),
-  osVersion: varchar("os_version", { length: 64 }),
-  deviceType: varchar("device_type", { length: 64 }), // e.g. "mobile", "desktop", "tablet"
-  userAgent: text("user_agent"),
+    utmSource: varchar("utm_source", { length: 64 }),
+    utmMedium: varchar("utm_medium", { length: 64 }),
+    utmCampaign: varchar("utm_campaign", { length: 64 }),
+    utmTerm: varchar("utm_term", { length: 64 }),
+    utmContent: varchar("utm_content", { length: 64 }),
 
-  duration: integer("duration"), // in seconds
+    eventType: varchar("event_type", { length: 64 }).notNull(), // e.g. "pageview"
+    eventName: varchar("event_name", { length: 128 }), // e.g. "cta_clicked"
+    eventData: jsonb("event_data"),
+
+    country: varchar("country", { length: 64 }), // ISO code
+    countryName: varchar("country_name", { length: 128 }), // localised, see project_settings.locale
+    continent: varchar("continent", { length: 2 }), // e.g. "EU"
+    city: varchar("city", { length: 128 }),
+    region: varchar("region", { length: 128 }),
+    postalCode: varchar("postal_code", { length: 16 }), // prefix only
+    latitude: doublePrecision("latitude"), // rounded to the project's geo precision
+    longitude: doublePrecision("longitude"),
+    timezone: varchar("timezone", { length: 64 }),
+    isp: varchar("isp", { length: 256 }),
+    asn: integer("asn"),
+    asOrganization: varchar("as_organization", { length: 256 }),
+    datacenter: boolean("datacenter").default(false).notNull(), // cloud/hosting traffic
+
+    browserName: varchar("browser_name", { length: 64 }),
+    browserVersion: varchar("browser_version", { length: 64 }),
+    osName: varchar("os_name", { length: 64 }),
+    osVersion: varchar("os_version", { length: 64 }),
+    deviceType: varchar("device_type", { length: 64 }), // "desktop", "mobile", "tablet", "tv", "console", "wearable" or "bot"
+    deviceVendor: varchar("device_vendor", { length: 64 }), // e.g. "Samsung"
+    deviceModel: varchar("device_model", { length: 128 }), // e.g. "SM-S918B", from Client Hints when available
+    userAgent: text("user_agent"),
+
+    screenWidth: integer("screen_width"),
+    screenHeight: integer("screen_height"),
+    screenSize: varchar("screen_size", { length: 8 }), // breakpoint of screen_width: xs, sm, md, lg, xl, xxl
+    viewportWidth: integer("viewport_width"),
+    language: varchar("language", { length: 35 }), // BCP 47, e.g. "en-US"
+
+    duration: integer("duration"), // in seconds
+
+    importId: uuid("import_id"), // set for events loaded by an import job
+  },
+  (t) => ({
+    // import rollbacks delete by import_id, only imported rows have one
+    importIdx: index("analytics_events_import_id_idx")
+      .on(t.importId)
+      .where(sql`${t.importId} IS NOT NULL`),
+    // range scans of a project, e.g. the monthly event quota count
+    projectTimestampIdx: index("analytics_events_project_id_timestamp_idx").on(
+      t.projectId,
+      t.timestamp
+    ),
+  })
+);
+
+// Issues (error events grouped by fingerprint)
+export const issues = pgTable(
+  "issues",
+  {
+    id: serial("id").primaryKey(),
+    uuid: uuid("uuid").defaultRandom().notNull().unique(),
+
+    projectId: uuid("project_id")
+      .notNull()
+      .references(() => projects.uuid, { onDelete: "cascade" }),
+
+    fingerprint: varchar("fingerprint", { length: 64 }).notNull(),
+    message: text("message").notNull(),
+    stack: text("stack"),
+    sourceFile: text("source_file"),
+    lineNumber: integer("line_number"),
+    columnNumber: integer("column_number"),
+    release: varchar("release", { length: 128 }), // latest release it was seen in
+
+    firstSeen: timestamp("first_seen").defaultNow().notNull(),
+    lastSeen: timestamp("last_seen").defaultNow().notNull(),
+    occurrences: integer("occurrences").default(0).notNull(),
+    affectedVisitors: integer("affected_visitors").default(0).notNull(),
+  },
+  (t) => ({
+    uniqueFingerprintPerProject: unique().on(t.projectId, t.fingerprint),
+  })
+);
+
+// Issue Visitors (used to count affected visitors once per issue)
+export const issueVisitors = pgTable(
+  "issue_visitors",
+  {
+    id: serial("id").primaryKey(),
+    issueId: uuid("issue_id")
+      .notNull()
+      .references(() => issues.uuid, { onDelete: "cascade" }),
+    visitorId: varchar("visitor_id", { length: 64 }).notNull(),
+  },
+  (t) => ({
+    uniqueVisitorPerIssue: unique().on(t.issueId, t.visitorId),
+  })
+);
+
+// Short Links
+export const shortLinks = pgTable("short_links", {
+  id: serial("id").primaryKey(),
+  uuid: uuid("uuid").defaultRandom().notNull().unique(),
+
+  projectId: uuid("project_id")
+    .notNull()
+    .references(() => projects.uuid, { onDelete: "cascade" }),
+
+  slug: varchar("slug", { length: 64 }).notNull().unique(), // served at /l/:slug
+  destinationUrl: text("destination_url").notNull(),
+  disabled: boolean("disabled").default(false).notNull(),
+  expiresAt: timestamp("expires_at"),
+
+  createdAt: timestamp("created_at").defaultNow().notNull(),
+  updatedAt: timestamp("updated_at").defaultNow().notNull(),
 });
 
+// Goals (conversions the analytics endpoints report on)
+export const goals = pgTable(
+  "goals",
+  {
+    id: serial("id").primaryKey(),
+    uuid: uuid("uuid").defaultRandom().notNull().unique(),
+
+    projectId: uuid("project_id")
+      .notNull()
+      .references(() => projects.uuid, { onDelete: "cascade" }),
+
+    name: varchar("name", { length: 100 }).notNull(),
+    type: varchar("type", { length: 16 }).notNull(), // "pageview", "event" or "revenue"
+    pathname: text("pathname"), // pageview goals, "*" matches any characters
+    eventName: varchar("event_name", { length: 128 }), // event and revenue goals
+    filters: text("filters").default("").notNull(), // e.g. "event_data.plan==pro"
+    revenueProperty: varchar("revenue_property", { length: 128 }), // event_data key of the amount
+
+    createdAt: timestamp("created_at").defaultNow().notNull(),
+    updatedAt: timestamp("updated_at").defaultNow().notNull(),
+  },
+  (t) => ({
+    uniqueGoalNamePerProject: unique().on(t.projectId, t.name),
+  })
+);
+
 // Reports
 export const reports = pgTable("reports", {
   id: serial("id").primaryKey(),